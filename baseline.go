@@ -0,0 +1,237 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package fint
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/ksoichiro/fint/common"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// BaselineVersion is the version of the baseline file format.
+	BaselineVersion = 1
+
+	// RuleIdUnusedBaselineEntry is the rule ID of the violations of baseline entries
+	// which no longer occur.
+	RuleIdUnusedBaselineEntry = "UnusedBaselineEntry"
+)
+
+// Baseline is a set of the known violations, which are not reported.
+// Violations are identified by the file, the rule ID and the fingerprint
+// of the line content, so that they survive changes of the other lines.
+// Files are relative to the directory of the baseline file,
+// so that the baseline is used from any directory.
+type Baseline struct {
+	Version    int             `json:"version"`
+	Violations []BaselineEntry `json:"violations"`
+	// dir is the absolute directory to which the files of the entries are relative
+	dir string
+}
+
+// BaselineEntry is the known violations of a rule with the same line content.
+type BaselineEntry struct {
+	File        string `json:"file"`
+	Rule        string `json:"rule"`
+	Fingerprint string `json:"fingerprint"`
+	Count       int    `json:"count"`
+}
+
+type baselineKey struct {
+	rule        string
+	fingerprint string
+}
+
+// fingerprint returns the fingerprint of the line content,
+// which does not depend on the indentation and the trailing spaces.
+func fingerprint(line string) string {
+	sum := sha1.Sum([]byte(strings.TrimSpace(line)))
+	return hex.EncodeToString(sum[:])
+}
+
+// realPath returns the absolute path of filename without symbolic links,
+// so that the same file has the same path from any directory.
+// Symbolic links are kept in the file which does not exist.
+func realPath(filename string) string {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return filename
+	}
+	if real, err := filepath.EvalSymlinks(abs); err == nil {
+		return real
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(abs)); err == nil {
+		return filepath.Join(dir, filepath.Base(abs))
+	}
+	return abs
+}
+
+// file returns the file of the entries for filename.
+func (b *Baseline) file(filename string) string {
+	if rel, err := filepath.Rel(b.dir, realPath(filename)); err == nil {
+		return filepath.ToSlash(rel)
+	}
+	return filepath.ToSlash(filename)
+}
+
+// path returns the path of the file of the entries to be shown,
+// which is relative to the current directory if possible.
+func (b *Baseline) path(file string) string {
+	abs := filepath.Join(b.dir, filepath.FromSlash(file))
+	if rel, err := filepath.Rel(realPath("."), abs); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return abs
+}
+
+// NewBaseline returns the baseline of the unfixed violations,
+// whose files are relative to the current directory until it is written.
+func NewBaseline(violations []common.Violation) *Baseline {
+	b := &Baseline{Version: BaselineVersion, Violations: []BaselineEntry{}}
+	b.dir = realPath(".")
+	counts := make(map[BaselineEntry]int)
+	for i := range violations {
+		v := violations[i]
+		if v.Fixed {
+			continue
+		}
+		counts[BaselineEntry{File: b.file(v.Filename), Rule: v.RuleId, Fingerprint: v.Fingerprint}]++
+	}
+	for e, n := range counts {
+		e.Count = n
+		b.Violations = append(b.Violations, e)
+	}
+	sort.Sort(baselineEntries(b.Violations))
+	return b
+}
+
+type baselineEntries []BaselineEntry
+
+func (a baselineEntries) Len() int      { return len(a) }
+func (a baselineEntries) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a baselineEntries) Less(i, j int) bool {
+	if a[i].File != a[j].File {
+		return a[i].File < a[j].File
+	}
+	if a[i].Rule != a[j].Rule {
+		return a[i].Rule < a[j].Rule
+	}
+	return a[i].Fingerprint < a[j].Fingerprint
+}
+
+// ReadBaseline reads the baseline file.
+func ReadBaseline(filename string) (b *Baseline, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return
+	}
+	b = new(Baseline)
+	if err = json.Unmarshal(data, b); err != nil {
+		return nil, common.NewError("invalid baseline file [" + filename + "]: " + err.Error())
+	}
+	if b.Version != BaselineVersion {
+		return nil, common.NewError("unsupported baseline file [" + filename + "]")
+	}
+	b.dir = realPath(filepath.Dir(filename))
+	return
+}
+
+// Write writes the baseline to the file.
+// Files of the entries are made relative to the directory of the file.
+func (b *Baseline) Write(filename string) error {
+	if dir := realPath(filepath.Dir(filename)); dir != b.dir {
+		for i := range b.Violations {
+			abs := filepath.Join(b.dir, filepath.FromSlash(b.Violations[i].File))
+			if rel, err := filepath.Rel(dir, abs); err == nil {
+				b.Violations[i].File = filepath.ToSlash(rel)
+			} else {
+				b.Violations[i].File = filepath.ToSlash(abs)
+			}
+		}
+		b.dir = dir
+		sort.Sort(baselineEntries(b.Violations))
+	}
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, append(data, common.LinefeedRune), 0666)
+}
+
+// counts returns the remaining counts of the entries for each file.
+func (b *Baseline) counts() map[string]map[baselineKey]int {
+	counts := make(map[string]map[baselineKey]int)
+	for _, e := range b.Violations {
+		if counts[e.File] == nil {
+			counts[e.File] = make(map[baselineKey]int)
+		}
+		counts[e.File][baselineKey{e.Rule, e.Fingerprint}] += e.Count
+	}
+	return counts
+}
+
+// countsOf returns the counts of the files only.
+func countsOf(counts map[string]map[baselineKey]int, files []string) map[string]map[baselineKey]int {
+	of := make(map[string]map[baselineKey]int)
+	for _, f := range files {
+		if c, ok := counts[f]; ok {
+			of[f] = c
+		}
+	}
+	return of
+}
+
+// applyBaseline removes the violations counted in counts from vmap
+// and decrements the counts. Violations are counted from the first line
+// so that the same ones are reported in every run.
+func applyBaseline(counts map[baselineKey]int, vmap map[int][]common.Violation) {
+	var ns []int
+	for n := range vmap {
+		ns = append(ns, n)
+	}
+	sort.Ints(ns)
+	for _, n := range ns {
+		vs := vmap[n]
+		var kept []common.Violation
+		for i := range vs {
+			k := baselineKey{vs[i].RuleId, vs[i].Fingerprint}
+			if !vs[i].Fixed && 0 < counts[k] {
+				counts[k]--
+				continue
+			}
+			kept = append(kept, vs[i])
+		}
+		if len(kept) != len(vs) {
+			vmap[n] = kept
+		}
+	}
+}
+
+// unusedEntries returns the violations of the entries remaining in counts.
+func (b *Baseline) unusedEntries(counts map[string]map[baselineKey]int) (violations []common.Violation) {
+	var files []string
+	for f := range counts {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		var entries []BaselineEntry
+		for k, n := range counts[f] {
+			if 0 < n {
+				entries = append(entries, BaselineEntry{File: f, Rule: k.rule, Fingerprint: k.fingerprint, Count: n})
+			}
+		}
+		sort.Sort(baselineEntries(entries))
+		for _, e := range entries {
+			violations = append(violations, common.Violation{Filename: b.path(e.File), RuleId: RuleIdUnusedBaselineEntry,
+				Severity: common.SeverityInfo, Message: "Baseline entry of " + e.Rule + " no longer occurs"})
+		}
+	}
+	return
+}
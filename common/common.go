@@ -6,6 +6,7 @@ package common
 import (
 	"errors"
 	"fmt"
+	"regexp"
 )
 
 const (
@@ -17,7 +18,10 @@ const (
 	Linefeed       = "\n"
 	LinefeedRune   = '\n'
 
+	DirConfigDefault            = ".fint"
 	DirBuiltin                  = "builtin"
+	DirCustom                   = "custom"
+	DirUserConfig               = "fint"
 	DirModules                  = "modules"
 	DirTargets                  = "targets"
 	DirLocales                  = "locales"
@@ -27,6 +31,8 @@ const (
 	DirCss                      = "css"
 	FileConfig                  = "config.json"
 	FileRuleSet                 = "ruleset.json"
+	FileIgnore                  = ".fintignore"
+	FileBaseline                = ".fint-baseline.json"
 	HtmlIndex                   = "index.html"
 	HtmlTmplIndex               = "_index.html"
 	HtmlTmplIndexSrclist        = "_index_srclist.html"
@@ -42,14 +48,30 @@ const (
 	TagMarkerClass              = "@MARKER_CLASS@"
 	TagHasViolations            = "@HAS_VIOLATIONS@"
 	TagLineNumber               = "@LINE@"
+	TagColumn                   = "@COLUMN@"
 	TagCode                     = "@CODE@"
 	TagViolationMsg             = "@VIOLATION_MSG@"
 	TagViolationMsglist         = "@VIOLATION_MSGLIST@"
 	TagSrclines                 = "@SRCLINES@"
 	TagSrclist                  = "@SRCLIST@"
+
+	TargetIdAll = "all"
+
+	// LocaleFallback is the locale of the messages used when the requested one is missing.
+	LocaleFallback = "en"
+
+	ModuleTypeBuiltin  = "builtin"
+	ModuleTypeExternal = "external"
+
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+	SeverityInfo    = "info"
+	SeverityOff     = "off"
+	SeverityDefault = SeverityWarning
 )
 
 var (
+	// BufSize is the default buffer size set by the deprecated Setbufsize of fint.
 	BufSize int
 )
 
@@ -63,6 +85,34 @@ type Opt struct {
 	Force      bool
 	Quiet      bool
 	Fix        bool
+	// DryRun computes the fixes without writing the files,
+	// and prints them as a unified diff.
+	DryRun     bool
+	Jobs       int
+	ShowRuleId bool
+	// FailOn is the lowest severity which makes the lint fail.
+	// Empty means SeverityDefault, and off means never.
+	FailOn string
+	// ReportUnusedSuppressions reports the suppression comments which suppress nothing.
+	ReportUnusedSuppressions bool
+	// Baseline is the baseline file of the violations not to be reported.
+	// For the baseline command, it is the file to be written.
+	Baseline string
+	// ReportUnusedBaseline reports the baseline entries which no longer occur.
+	ReportUnusedBaseline bool
+	// DiffBase is the git revision, and only the violations in the lines
+	// changed from it are reported.
+	DiffBase string
+	// Staged reports only the violations in the staged lines.
+	Staged bool
+	// Stdin lints stdin as the file StdinFilename instead of SrcRoot.
+	Stdin         bool
+	StdinFilename string
+	// Verbose prints the config directory and the targets in use.
+	Verbose bool
+	// BufSize is the buffer size used for reading source files.
+	// Zero means the default buffer size.
+	BufSize int
 }
 
 type LocalizedRule struct {
@@ -82,25 +132,61 @@ type LocalizedTarget struct {
 }
 
 type Rule struct {
-	Id      string
-	Args    []interface{}
+	Id   string
+	Args []interface{}
+	// Severity is one of error, warning, info and off.
+	// Empty means SeverityDefault.
+	Severity string
+	// Remove removes the rule of the same ID from the extended target.
+	Remove bool
+	// Message is the messages keyed by the locales.
+	// Use LocalizedMessage to get the message of a locale.
 	Message map[string]string
+	// Regexps are the compiled regular expression arguments,
+	// which have the same indices as Args.
+	Regexps []*regexp.Regexp `json:"-"`
+}
+
+// LocalizedMessage returns the message of the rule in locale.
+// If it is missing, the message in LocaleFallback, and then the rule ID is returned.
+func (r Rule) LocalizedMessage(locale string) string {
+	if msg := r.Message[locale]; msg != "" {
+		return msg
+	}
+	if msg := r.Message[LocaleFallback]; msg != "" {
+		return msg
+	}
+	return r.Id
 }
 
 type Module struct {
 	Id      string
 	Pattern string
 	Rules   []Rule
+	// Exclude is the patterns of the files not to be checked
+	// with the syntax of .fintignore.
+	Exclude []string
+	// Regexp is the compiled Pattern.
+	Regexp *regexp.Regexp `json:"-"`
 }
 
 type RuleSet struct {
 	Id          string
 	Description string
-	Modules     []Module
+	// Comment is the start of the line comments of the source files,
+	// which is used for suppression comments. Empty disables them.
+	Comment string
+	// Exclude is the patterns of the files not to be checked
+	// by any module of the rule set with the syntax of .fintignore.
+	Exclude []string
+	Modules []Module
 }
 
 type Target struct {
-	Id       string
+	Id string
+	// Extends is the ID of the target which this target inherits.
+	// Rule sets, modules and rules are merged into it by their IDs.
+	Extends  string
 	RuleSets []RuleSet
 	Locales  []string
 }
@@ -111,6 +197,8 @@ type ModuleConfig struct {
 	Description string
 	Executable  string
 	Args        []interface{}
+	// Timeout is the time limit of the external module for each file in seconds.
+	Timeout float64
 }
 
 type Config struct {
@@ -118,12 +206,45 @@ type Config struct {
 	Targets       []Target
 }
 
+// Violation is a violation of a rule.
+// Column and EndColumn are the 1-based byte columns of the violating range in the line,
+// and Offset and EndOffset are the 0-based byte offsets of the range in the file.
+// The ends are exclusive. Column is 0 if the module does not know the range.
+// RuleId is set by the module, and ModuleId, RuleSetId, TargetId and Severity
+// are set by the Linter.
 type Violation struct {
-	Filename string
-	Line     int
-	Message  string
-	Fixed    bool
-	Fix      string
+	Filename  string
+	RuleId    string
+	ModuleId  string
+	RuleSetId string
+	TargetId  string
+	Severity  string
+	Line      int
+	Column    int
+	EndColumn int
+	Offset    int
+	EndOffset int
+	// Fingerprint identifies the content of the line.
+	Fingerprint string
+	Message     string
+	Fixed       bool
+	Fix         string
+}
+
+// SeverityLevel returns the level of the severity s, which is higher for
+// more severe ones. It returns false if s is not a severity.
+func SeverityLevel(s string) (level int, ok bool) {
+	switch s {
+	case SeverityOff:
+		return 0, true
+	case SeverityInfo:
+		return 1, true
+	case SeverityWarning, "":
+		return 2, true
+	case SeverityError:
+		return 3, true
+	}
+	return
 }
 
 func NewError(message string) error {
@@ -131,15 +252,22 @@ func NewError(message string) error {
 }
 
 func PrintUsage() {
-	fmt.Println(`fint is a lightweight source code check tool.
+	fmt.Print(`fint is a lightweight source code check tool.
 
 Usage:
 	fint command [options]
 
 Command:
-	run      execute lint
-	help     show this help
-	version  show version of fint
+	run          execute lint
+	validate     check config files
+	baseline     write current violations to baseline file
+	list-targets show available targets and where they come from
+	init         write builtin config to .fint for customization
+	locales check
+	             show missing or orphaned messages in locales
+	help         show this help
+	version      show version of fint
+
 `)
 }
 
@@ -0,0 +1,318 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package fint
+
+import (
+	"encoding/json"
+	"github.com/ksoichiro/fint/common"
+	"github.com/ksoichiro/fint/modules"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func dirExists(path string) error {
+	if _, err := os.Stat(path); err != nil && os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// targetIds returns the target IDs separated with commas in id.
+// TargetIdAll is replaced with all the targets in the layers.
+func targetIds(id string, layers []ConfigLayer) (ids []string) {
+	seen := make(map[string]bool)
+	add := func(id string) {
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	for _, s := range strings.Split(id, ",") {
+		s = strings.TrimSpace(s)
+		switch s {
+		case "":
+		case common.TargetIdAll:
+			for _, t := range ListTargets(layers) {
+				add(t.Id)
+			}
+		default:
+			add(s)
+		}
+	}
+	return
+}
+
+// LoadConfig loads the modules and the targets specified by o from the config layers.
+// Several targets can be specified by separating them with commas.
+// If the config files have any problems, a *ValidationError is returned.
+func LoadConfig(o *common.Opt) (config *common.Config, err error) {
+	// Get config directory(.fint), which is optional with the embedded config
+	pathConfig := o.ConfigPath
+	if pathConfig != "" {
+		if err = dirExists(pathConfig); err != nil {
+			return
+		}
+	}
+	layers := ConfigLayers(o)
+
+	// Get target ID directories
+	ids := targetIds(o.Id, layers)
+	if len(ids) == 0 {
+		return nil, common.NewError("no matching target to [" + o.Id + "]")
+	}
+	var targets []ConfigLayer
+	for _, id := range ids {
+		_, layer, ok := findTarget(layers, id)
+		if !ok {
+			return nil, common.NewError("no matching target to [" + id + "]")
+		}
+		targets = append(targets, layer)
+	}
+
+	if err = checkBuiltinModules(pathConfig); err != nil {
+		return
+	}
+
+	config = new(common.Config)
+	var problems []Problem
+	if config.ModuleConfigs, problems, err = loadLayerModuleConfigs(layers); err != nil {
+		return nil, err
+	}
+
+	for i, id := range ids {
+		target, targetProblems, err := loadTarget(layers, targets[i], id, config, nil)
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, common.NewError("no matching target to [" + id + "]")
+			}
+			return nil, err
+		}
+		problems = appendProblems(problems, targetProblems...)
+		config.Targets = append(config.Targets, target)
+	}
+	if 0 < len(problems) {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return
+}
+
+// loadLayerModuleConfigs loads the modules in all the layers.
+// Modules in the former layers hide the ones of the same IDs.
+func loadLayerModuleConfigs(layers []ConfigLayer) (configs []common.ModuleConfig, problems []Problem, err error) {
+	seen := make(map[string]bool)
+	for _, layer := range layers {
+		c, p, err := loadModuleConfigs(layer)
+		if err != nil {
+			return nil, nil, err
+		}
+		problems = append(problems, p...)
+		for i := range c {
+			if !seen[c[i].Id] {
+				seen[c[i].Id] = true
+				configs = append(configs, c[i])
+			}
+		}
+	}
+	return
+}
+
+// checkBuiltinModules returns an error if the builtin layer in pathConfig exists without modules.
+func checkBuiltinModules(pathConfig string) error {
+	if pathConfig == "" {
+		return nil
+	}
+	if err := dirExists(filepath.Join(pathConfig, common.DirBuiltin)); err != nil {
+		return nil
+	}
+	pathModules := filepath.Join(pathConfig, common.DirBuiltin, common.DirModules)
+	if err := dirExists(pathModules); err != nil {
+		return common.NewError("modules directory not found in [" + pathModules + "]")
+	}
+	return nil
+}
+
+// loadModuleConfigs loads modules/*/config.json in the layer.
+func loadModuleConfigs(layer ConfigLayer) (configs []common.ModuleConfig, problems []Problem, err error) {
+	for _, entry := range layer.readDir(common.DirModules) {
+		if !entry.IsDir() {
+			continue
+		}
+		// entry name is the name of module
+		entryPath := layer.path(path.Join(common.DirModules, entry.Name()))
+		name := path.Join(common.DirModules, entry.Name(), common.FileConfig)
+		file := layer.path(name)
+		var configBytes []byte
+		configBytes, err = layer.readFile(name)
+		if err != nil {
+			return
+		}
+		if p := validateModuleConfig(file, configBytes); 0 < len(p) {
+			problems = append(problems, p...)
+			continue
+		}
+
+		var c common.ModuleConfig
+		json.Unmarshal(configBytes, &c)
+
+		// Set name as Id to be searchable
+		c.Id = entry.Name()
+		if c.Type == common.ModuleTypeExternal {
+			// Relative paths are relative to the module directory,
+			// and names without separators are searched in PATH.
+			if !filepath.IsAbs(c.Executable) && strings.ContainsAny(c.Executable, "/\\") {
+				c.Executable = filepath.Join(entryPath, c.Executable)
+			}
+		}
+		configs = append(configs, c)
+	}
+	return
+}
+
+// loadTarget loads ruleset.json and the locales of the target id in the layer.
+// If the target extends another target, it is looked up in the layers
+// and merged. chain is the IDs of the targets extending this target.
+// The modules in the target are resolved with config.
+func loadTarget(layers []ConfigLayer, layer ConfigLayer, id string, config *common.Config, chain []string) (target common.Target, problems []Problem, err error) {
+	// Load target ruleset
+	dir := path.Join(common.DirTargets, id)
+	file := layer.path(path.Join(dir, common.FileRuleSet))
+	var configBytes []byte
+	configBytes, err = layer.readFile(path.Join(dir, common.FileRuleSet))
+	if err != nil {
+		return
+	}
+	if problems = validateRuleSet(file, configBytes, id, config); 0 < len(problems) {
+		// Locales cannot be checked without valid rule sets
+		return
+	}
+	json.Unmarshal(configBytes, &target)
+	target.Id = id
+	removals := takeRemovals(&target)
+
+	// Load target locales
+	for _, entry := range layer.readDir(path.Join(dir, common.DirLocales)) {
+		locale := strings.TrimSuffix(entry.Name(), path.Ext(entry.Name()))
+
+		// Get contents of en.json, ja.json, ...
+		nameLocale := path.Join(dir, common.DirLocales, entry.Name())
+		fileLocale := layer.path(nameLocale)
+		var configBytes []byte
+		configBytes, _ = layer.readFile(nameLocale)
+		if p := validateLocale(fileLocale, configBytes, target); 0 < len(p) {
+			problems = append(problems, p...)
+			continue
+		}
+
+		var lt common.LocalizedTarget
+		json.Unmarshal(configBytes, &lt)
+
+		// Pass all localized messages for each rules by their IDs
+		messages := localeMessages(lt)
+		for i := range target.RuleSets {
+			rs := target.RuleSets[i]
+			for j := range rs.Modules {
+				m := rs.Modules[j]
+				for k := range m.Rules {
+					msg, ok := messages[localeKey{rs.Id, m.Id, m.Rules[k].Id}]
+					if !ok {
+						continue
+					}
+					if m.Rules[k].Message == nil {
+						m.Rules[k].Message = make(map[string]string)
+					}
+					m.Rules[k].Message[locale] = msg
+				}
+			}
+		}
+		target.Locales = append(target.Locales, locale)
+	}
+	if 0 < len(problems) {
+		return
+	}
+
+	if target.Extends != "" {
+		chain = append(chain[:len(chain):len(chain)], id)
+		if cycle, ok := cyclicExtends(chain, target.Extends); ok {
+			problems = append(problems, Problem{File: file, Location: "extends", Message: "cyclic extends [" + cycle + "]"})
+			return
+		}
+		_, l, ok := findTarget(layers, target.Extends)
+		if !ok {
+			problems = append(problems, Problem{File: file, Location: "extends", Message: "no matching target to [" + target.Extends + "]"})
+			return
+		}
+		var parent common.Target
+		if parent, problems, err = loadTarget(layers, l, target.Extends, config, chain); err != nil || 0 < len(problems) {
+			return
+		}
+		if target, problems = mergeTarget(file, parent, target, removals, config); 0 < len(problems) {
+			return
+		}
+	}
+
+	// Compile the patterns of the modules
+	for i := range target.RuleSets {
+		rs := target.RuleSets[i]
+		for j := range rs.Modules {
+			mod, ok := lookupModule(config, rs.Modules[j].Id)
+			if !ok {
+				return target, nil, errModuleNotRegistered(config, target, rs, rs.Modules[j])
+			}
+			if err = modules.Compile(&rs.Modules[j], mod); err != nil {
+				return target, nil, errInvalidPattern(target, rs, rs.Modules[j], err)
+			}
+		}
+	}
+	return
+}
+
+// lookupModule returns the module used for the ID.
+// External modules declared in the config take precedence over registered modules.
+func lookupModule(config *common.Config, id string) (mod modules.Module, ok bool) {
+	for i := range config.ModuleConfigs {
+		mc := config.ModuleConfigs[i]
+		if mc.Id == id && mc.Type == common.ModuleTypeExternal {
+			e := modules.NewExternal(mc.Executable, mc.Args)
+			e.Timeout = time.Duration(mc.Timeout * float64(time.Second))
+			return e, true
+		}
+	}
+	return modules.Lookup(id)
+}
+
+func invalidPatternMessage(target common.Target, rs common.RuleSet, m common.Module, ce *modules.CompileError) string {
+	msg := "invalid pattern [" + ce.Pattern + "]"
+	if ce.Rule != "" {
+		msg += " in rule [" + ce.Rule + "]"
+	}
+	return msg + " of module [" + m.Id + "] in rule set [" + rs.Id + "] of target [" + target.Id + "]: " + ce.Err.Error()
+}
+
+func errInvalidPattern(target common.Target, rs common.RuleSet, m common.Module, err error) error {
+	ce, ok := err.(*modules.CompileError)
+	if !ok {
+		return err
+	}
+	return common.NewError(invalidPatternMessage(target, rs, m, ce))
+}
+
+// moduleNotRegisteredMessage returns the message for the module m which is not registered.
+// Modules declared as builtin in config are reported as builtin modules,
+// which are expected to be registered by fint or the programs using fint.
+func moduleNotRegisteredMessage(config *common.Config, target common.Target, rs common.RuleSet, m common.Module) string {
+	kind := "module"
+	for i := range config.ModuleConfigs {
+		if config.ModuleConfigs[i].Id == m.Id && config.ModuleConfigs[i].Type == common.ModuleTypeBuiltin {
+			kind = "builtin module"
+		}
+	}
+	return kind + " [" + m.Id + "] used in rule set [" + rs.Id + "] of target [" + target.Id + "] is not registered"
+}
+
+func errModuleNotRegistered(config *common.Config, target common.Target, rs common.RuleSet, m common.Module) error {
+	return common.NewError(moduleNotRegisteredMessage(config, target, rs, m))
+}
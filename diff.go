@@ -0,0 +1,221 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package fint
+
+import (
+	"bufio"
+	"bytes"
+	"github.com/ksoichiro/fint/common"
+	"github.com/ksoichiro/fint/modules"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	hunkExp   = regexp.MustCompile("^@@ -[0-9]+(?:,[0-9]+)? \\+([0-9]+)(?:,([0-9]+))? @@")
+	binaryExp = regexp.MustCompile(`^Binary files .* and ("?b/.*) differ$`)
+)
+
+// lineRange is a range of the changed lines. The end is inclusive.
+type lineRange struct {
+	start, end int
+}
+
+// changes is the changed lines of the files keyed by their absolute paths.
+type changes map[string][]lineRange
+
+// git runs git in dir and returns its output.
+func git(dir string, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	// Paths are not quoted for non-ASCII characters
+	cmd := exec.Command("git", append([]string{"-c", "core.quotePath=false"}, args...)...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		msg := "git " + args[0] + " failed: " + err.Error()
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			msg += ": " + s
+		}
+		return nil, common.NewError(msg)
+	}
+	return stdout.Bytes(), nil
+}
+
+// gitChanges returns the lines in srcRoot changed from base and the root of the repository.
+// If staged is true, the staged changes are used instead of the working tree.
+// Otherwise all the lines of the untracked files which are not ignored are changed.
+func gitChanges(srcRoot, base string, staged bool) (c changes, top string, err error) {
+	dir := srcRoot
+	if fi, err := os.Stat(srcRoot); err == nil && !fi.IsDir() {
+		dir = filepath.Dir(srcRoot)
+	}
+	out, err := git(dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return
+	}
+	top = strings.TrimSpace(string(out))
+	// Prefixes are fixed against diff.noprefix and diff.mnemonicPrefix
+	args := []string{"diff", "--unified=0", "--no-color", "--no-ext-diff", "--diff-filter=ACMR", "--src-prefix=a/", "--dst-prefix=b/"}
+	if staged {
+		args = append(args, "--cached")
+	}
+	if base != "" {
+		args = append(args, base)
+	}
+	abs, err := filepath.Abs(srcRoot)
+	if err != nil {
+		return
+	}
+	args = append(args, "--", abs)
+	if out, err = git(dir, args...); err != nil {
+		return
+	}
+	if c, err = parseDiff(top, out); err != nil || staged {
+		return
+	}
+	if out, err = git(dir, "ls-files", "--others", "--exclude-standard", "--full-name", "-z", "--", abs); err != nil {
+		return
+	}
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name != "" {
+			c[filepath.Join(top, filepath.FromSlash(name))] = []lineRange{{1, math.MaxInt32}}
+		}
+	}
+	return
+}
+
+// stagedLines returns the lines of filename in the index of the repository top.
+func stagedLines(top, filename string) (lines []string, err error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return
+	}
+	// Paths of git are resolved with symbolic links
+	if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+		abs = resolved
+	}
+	rel, err := filepath.Rel(top, abs)
+	if err != nil {
+		return
+	}
+	out, err := git(top, "show", ":"+filepath.ToSlash(rel))
+	if err != nil {
+		return
+	}
+	return modules.ReadLinesFrom(bytes.NewReader(out))
+}
+
+// diffPath returns the path of the new file in a header of the diff of git.
+// Paths with spaces are followed by a tab, and the ones with special characters are quoted.
+func diffPath(name string) (path string, ok bool) {
+	name = strings.TrimSuffix(name, "\t")
+	if strings.HasPrefix(name, `"`) {
+		var err error
+		if name, err = strconv.Unquote(name); err != nil {
+			return
+		}
+	}
+	if !strings.HasPrefix(name, "b/") {
+		return
+	}
+	return strings.TrimPrefix(name, "b/"), true
+}
+
+// parseDiff parses the unified diff of git whose paths are relative to top.
+// It returns an error if no files are found in the diff which is not empty,
+// so that the changes are not ignored silently.
+func parseDiff(top string, diff []byte) (c changes, err error) {
+	c = make(changes)
+	var file string
+	s := bufio.NewScanner(bytes.NewReader(diff))
+	for s.Scan() {
+		line := s.Text()
+		if m := binaryExp.FindStringSubmatch(line); m != nil {
+			if name, ok := diffPath(m[1]); ok {
+				c[filepath.Join(top, filepath.FromSlash(name))] = []lineRange{}
+			}
+			continue
+		}
+		if strings.HasPrefix(line, "+++ ") {
+			file = ""
+			if name, ok := diffPath(strings.TrimPrefix(line, "+++ ")); ok {
+				file = filepath.Join(top, filepath.FromSlash(name))
+				// Touched files are linted even if only lines are deleted
+				c[file] = []lineRange{}
+			}
+			continue
+		}
+		m := hunkExp.FindStringSubmatch(line)
+		if file == "" || m == nil {
+			continue
+		}
+		start, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+		if 0 < count {
+			c[file] = append(c[file], lineRange{start, start + count - 1})
+		}
+	}
+	if err = s.Err(); err != nil {
+		return
+	}
+	if len(c) == 0 && len(bytes.TrimSpace(diff)) != 0 {
+		err = common.NewError("no changed files are found in the output of git diff.")
+	}
+	return
+}
+
+// ranges returns the changed lines of filename and whether the file is changed.
+func (c changes) ranges(filename string) (r []lineRange, changed bool) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return
+	}
+	if r, changed = c[abs]; !changed {
+		// Paths of git are resolved with symbolic links
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			r, changed = c[resolved]
+		}
+	}
+	return
+}
+
+// filter returns the changed sources with their changed lines.
+func (c changes) filter(sources []source) (changed []source) {
+	for _, s := range sources {
+		if r, ok := c.ranges(s.filename); ok {
+			s.diff, s.changed = true, r
+			changed = append(changed, s)
+		}
+	}
+	return
+}
+
+// filterChanged removes the violations out of the changed lines from vmap.
+// Violations of the whole file, whose line is 0, are kept.
+func filterChanged(r []lineRange, vmap map[int][]common.Violation) {
+	for n := range vmap {
+		if n == 0 {
+			continue
+		}
+		changed := false
+		for i := range r {
+			if r[i].start <= n && n <= r[i].end {
+				changed = true
+				break
+			}
+		}
+		if !changed {
+			delete(vmap, n)
+		}
+	}
+}
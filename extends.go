@@ -0,0 +1,197 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package fint
+
+import (
+	"github.com/ksoichiro/fint/common"
+	"github.com/ksoichiro/fint/modules"
+	"strings"
+)
+
+// removal is a rule to be removed from the extended target.
+type removal struct {
+	ruleSet, module, rule string
+}
+
+// takeRemovals removes the rules marked with Remove from target and returns them.
+func takeRemovals(target *common.Target) (removals []removal) {
+	for i := range target.RuleSets {
+		rs := &target.RuleSets[i]
+		for j := range rs.Modules {
+			m := &rs.Modules[j]
+			var rules []common.Rule
+			for k := range m.Rules {
+				if m.Rules[k].Remove {
+					removals = append(removals, removal{rs.Id, m.Id, m.Rules[k].Id})
+				} else {
+					rules = append(rules, m.Rules[k])
+				}
+			}
+			m.Rules = rules
+		}
+	}
+	return
+}
+
+// cyclicExtends returns the cycle as a message if id is already in the chain of the extending targets.
+func cyclicExtends(chain []string, id string) (cycle string, ok bool) {
+	for i := range chain {
+		if chain[i] == id {
+			return strings.Join(append(chain[i:], id), " -> "), true
+		}
+	}
+	return
+}
+
+// mergeTarget merges child into parent, which is the target extended by child.
+// Rule sets, modules and rules of the same IDs are overridden by the items
+// given in child, and the others are appended.
+// file is ruleset.json of child, in which the problems are reported.
+func mergeTarget(file string, parent, child common.Target, removals []removal, config *common.Config) (target common.Target, problems []Problem) {
+	target = parent
+	target.Id = child.Id
+	target.Extends = child.Extends
+	target.Locales = mergeLocales(parent.Locales, child.Locales)
+	target.RuleSets = append([]common.RuleSet(nil), parent.RuleSets...)
+	for i := range target.RuleSets {
+		target.RuleSets[i].Modules = append([]common.Module(nil), target.RuleSets[i].Modules...)
+		for j := range target.RuleSets[i].Modules {
+			target.RuleSets[i].Modules[j].Rules = append([]common.Rule(nil), target.RuleSets[i].Modules[j].Rules...)
+		}
+	}
+
+	for _, r := range removals {
+		rs := findRuleSet(target.RuleSets, r.ruleSet)
+		var m *common.Module
+		if rs != nil {
+			m = findModule(rs.Modules, r.module)
+		}
+		k := -1
+		if m != nil {
+			k = findRule(m.Rules, r.rule)
+		}
+		if k < 0 {
+			problems = append(problems, Problem{File: file, Message: "rule [" + r.rule + "] of module [" + r.module +
+				"] in rule set [" + r.ruleSet + "] to remove is not in target [" + parent.Id + "]"})
+			continue
+		}
+		m.Rules = append(m.Rules[:k], m.Rules[k+1:]...)
+	}
+
+	for i := range child.RuleSets {
+		crs := child.RuleSets[i]
+		rs := findRuleSet(target.RuleSets, crs.Id)
+		if rs == nil {
+			target.RuleSets = append(target.RuleSets, common.RuleSet{Id: crs.Id})
+			rs = &target.RuleSets[len(target.RuleSets)-1]
+		}
+		if crs.Description != "" {
+			rs.Description = crs.Description
+		}
+		if crs.Comment != "" {
+			rs.Comment = crs.Comment
+		}
+		if crs.Exclude != nil {
+			rs.Exclude = crs.Exclude
+		}
+		for j := range crs.Modules {
+			cm := crs.Modules[j]
+			mLoc := indexLoc(childLoc(indexLoc("rulesets", i), "modules"), j)
+			m := findModule(rs.Modules, cm.Id)
+			if m == nil {
+				if cm.Pattern == "" {
+					problems = append(problems, Problem{File: file, Location: childLoc(mLoc, "pattern"),
+						Message: "is required for the modules which are not in target [" + parent.Id + "]"})
+				}
+				rs.Modules = append(rs.Modules, common.Module{Id: cm.Id})
+				m = &rs.Modules[len(rs.Modules)-1]
+			}
+			if cm.Pattern != "" {
+				m.Pattern = cm.Pattern
+			}
+			if cm.Exclude != nil {
+				m.Exclude = cm.Exclude
+			}
+			mod, _ := lookupModule(config, cm.Id)
+			for k := range cm.Rules {
+				problems = append(problems, mergeRule(file, indexLoc(childLoc(mLoc, "rules"), k), m, cm.Rules[k], mod, parent.Id)...)
+			}
+		}
+	}
+	return
+}
+
+// mergeRule overrides the rule of the same ID in m with r, or appends r.
+func mergeRule(file, loc string, m *common.Module, r common.Rule, mod modules.Module, parentId string) (problems []Problem) {
+	k := findRule(m.Rules, r.Id)
+	if k < 0 {
+		if d, ok := mod.(modules.ArgsDescriber); ok && r.Args == nil {
+			for _, a := range d.RuleArgs() {
+				if !a.Optional {
+					problems = append(problems, Problem{File: file, Location: childLoc(loc, "args"),
+						Message: "is required for the rules which are not in target [" + parentId + "]"})
+					break
+				}
+			}
+		}
+		m.Rules = append(m.Rules, r)
+		return
+	}
+	rule := &m.Rules[k]
+	if r.Args != nil {
+		rule.Args = r.Args
+	}
+	if r.Severity != "" {
+		rule.Severity = r.Severity
+	}
+	messages := make(map[string]string)
+	for locale, msg := range rule.Message {
+		messages[locale] = msg
+	}
+	for locale, msg := range r.Message {
+		if msg != "" {
+			messages[locale] = msg
+		}
+	}
+	rule.Message = messages
+	return
+}
+
+// mergeLocales returns the locales of parent and the ones added by child.
+func mergeLocales(parent, child []string) []string {
+	locales := append([]string(nil), parent...)
+	for _, l := range child {
+		if !contains(locales, l) {
+			locales = append(locales, l)
+		}
+	}
+	return locales
+}
+
+func findRuleSet(rss []common.RuleSet, id string) *common.RuleSet {
+	for i := range rss {
+		if rss[i].Id == id {
+			return &rss[i]
+		}
+	}
+	return nil
+}
+
+func findModule(ms []common.Module, id string) *common.Module {
+	for i := range ms {
+		if ms[i].Id == id {
+			return &ms[i]
+		}
+	}
+	return nil
+}
+
+func findRule(rules []common.Rule, id string) int {
+	for i := range rules {
+		if rules[i].Id == id {
+			return i
+		}
+	}
+	return -1
+}
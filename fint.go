@@ -5,24 +5,38 @@ package fint
 
 import (
 	"bufio"
-	"encoding/json"
 	"fmt"
 	"github.com/ksoichiro/fint/common"
 	"github.com/ksoichiro/fint/modules"
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 )
 
-var (
+// Linter lints source files with a loaded configuration.
+// Each Linter owns its options, configuration and results, so several Linters
+// can run in the same process at the same time.
+type Linter struct {
+	mu         sync.Mutex
 	opt        *common.Opt
 	config     *common.Config
+	baseline   *Baseline
 	violations []common.Violation
-	term       string
-)
+	results    map[string]map[int][]common.Violation
+	patches    []string
+}
+
+// NewLinter returns a Linter for the options o.
+// c may be nil, in which case LoadConfig must be called before Lint.
+func NewLinter(o *common.Opt, c *common.Config) *Linter {
+	return &Linter{opt: o, config: c}
+}
 
 func CopyFile(src, dst string) (err error) {
 	fin, err := os.Open(src)
@@ -58,39 +72,93 @@ func CopyDir(src, dst string) {
 	}
 }
 
-func printViolation(v common.Violation) {
+func printViolation(w io.Writer, term string, v common.Violation, showRuleId bool) {
+	// Labels and colors compatible with Xcode and clang
+	label, color := "warning", "35"
+	switch v.Severity {
+	case common.SeverityError:
+		label, color = "error", "31"
+	case common.SeverityInfo:
+		label, color = "note", "30"
+	}
+	location := fmt.Sprintf("%s:%d:%d", v.Filename, v.Line, column(v))
+	if v.Line == 0 {
+		// Violations of the whole file
+		location = v.Filename
+	}
 	var format string
 	if term == "dumb" {
-		format = "%s:%d:1: warning: %s\n"
+		format = "%s: %s: %s\n"
 	} else {
-		format = "[1;37m%s:%d:1: [1;35mwarning:[1;37m %s[m\n"
+		format = "[1;37m%s: [1;" + color + "m%s:[1;37m %s[m\n"
+	}
+	msg := v.Message
+	if showRuleId && v.RuleId != "" {
+		msg += " [" + v.RuleId + "]"
 	}
-	fmt.Printf(format, v.Filename, v.Line, v.Message)
+	fmt.Fprintf(w, format, location, label, msg)
+}
+
+// column returns the column where the violation starts.
+// Violations without columns start at the beginning of the line.
+func column(v common.Violation) int {
+	if v.Column == 0 {
+		return 1
+	}
+	return v.Column
+}
+
+// template returns the HTML report template in the config layers.
+func (l *Linter) template() reportTemplate {
+	layer, dir := findTemplate(ConfigLayers(l.opt), l.opt.Template)
+	return reportTemplate{layer, dir}
+}
+
+// reportTemplate is the directory of an HTML report template in a config layer.
+type reportTemplate struct {
+	layer ConfigLayer
+	dir   string
 }
 
-func printReportHeader() {
+func (t reportTemplate) read(name string) string {
+	content, _ := t.layer.readFile(path.Join(t.dir, name))
+	return string(content)
+}
+
+func (t reportTemplate) copyFile(name, dst string) error {
+	return copyFSFile(t.layer.FS, path.Join(t.dir, name), dst)
+}
+
+func (t reportTemplate) copyDir(name, dst string) error {
+	return copyFSDir(t.layer.FS, path.Join(t.dir, name), dst)
+}
+
+func (l *Linter) printReportHeader() {
+	opt := l.opt
 	if opt.Html == "" {
 		return
 	}
 	os.MkdirAll(filepath.Join(opt.Html, common.DirJs), 0777)
 	os.MkdirAll(filepath.Join(opt.Html, common.DirCss), 0777)
-	pathTmpl := filepath.Join(opt.ConfigPath, common.DirBuiltin, common.DirTemplates, opt.Template)
-	CopyFile(filepath.Join(pathTmpl, common.HtmlTmplIndex), filepath.Join(opt.Html, common.HtmlIndex))
-	CopyDir(filepath.Join(pathTmpl, common.DirJs), filepath.Join(opt.Html, common.DirJs))
-	CopyDir(filepath.Join(pathTmpl, common.DirCss), filepath.Join(opt.Html, common.DirCss))
+	tmpl := l.template()
+	tmpl.copyFile(common.HtmlTmplIndex, filepath.Join(opt.Html, common.HtmlIndex))
+	tmpl.copyDir(common.DirJs, filepath.Join(opt.Html, common.DirJs))
+	tmpl.copyDir(common.DirCss, filepath.Join(opt.Html, common.DirCss))
 }
 
-func printReportBody(filename string, vcnt int, vmap map[int][]common.Violation) {
+func (l *Linter) printReportBody(filename string, vcnt int, vmap map[int][]common.Violation) {
+	opt := l.opt
 	if opt.Html == "" {
 		return
 	}
-	MkReportDir(true)
+	l.MkReportDir(true)
+	tmpl := l.template()
 
 	// Add source file entry to index
 	f, _ := os.OpenFile(filepath.Join(opt.Html, common.HtmlTmplIndexSrclist), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	defer f.Close()
 
-	srclist := readFile(filepath.Join(opt.ConfigPath, common.DirBuiltin, common.DirTemplates, opt.Template, common.HtmlTmplIndexSrclist))
+	srclist := tmpl.read(common.HtmlTmplIndexSrclist)
 	srclist = replaceTag(srclist, common.TagSrcPath, filename)
 	srclist = replaceTag(srclist, common.TagViolations, fmt.Sprintf("%d", vcnt))
 
@@ -106,9 +174,9 @@ func printReportBody(filename string, vcnt int, vmap map[int][]common.Violation)
 	os.MkdirAll(filepath.Join(opt.Html, common.DirSrc, filepath.Dir(filename)), 0777)
 
 	pathDetail := filepath.Join(opt.Html, common.DirSrc, filename+".html")
-	CopyFile(filepath.Join(opt.ConfigPath, common.DirBuiltin, common.DirTemplates, opt.Template, common.HtmlTmplSrc), pathDetail)
-	replaceTagInFile(pathDetail, common.TagRootPath, rootPath)
-	replaceTagInFile(pathDetail, common.TagSrcPath, filename)
+	tmpl.copyFile(common.HtmlTmplSrc, pathDetail)
+	l.replaceTagInFile(pathDetail, common.TagRootPath, rootPath)
+	l.replaceTagInFile(pathDetail, common.TagSrcPath, filename)
 
 	pathDetailSrcline := pathDetail + ".srcline.tmp"
 	fsrcline, _ := os.OpenFile(pathDetailSrcline, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
@@ -116,12 +184,12 @@ func printReportBody(filename string, vcnt int, vmap map[int][]common.Violation)
 
 	fsrc, _ := os.Open(filename)
 	defer fsrc.Close()
-	r := bufio.NewReaderSize(fsrc, common.BufSize)
+	r := bufio.NewReaderSize(fsrc, l.bufSize())
 	for n := 1; true; n++ {
 		line, _, err := readLine(r)
 		// Replace prefix spaces to nbsp
 		for l1, l2 := line, ""; true; l1 = l2 {
-			l2 = replaceTag(l1, "^( *) ([^ ])", "$1&nbsp;$2")
+			l2 = tagRegexp("^( *) ([^ ])").ReplaceAllString(l1, "$1&nbsp;$2")
 			if l1 == l2 {
 				line = l2
 				break
@@ -138,7 +206,7 @@ func printReportBody(filename string, vcnt int, vmap map[int][]common.Violation)
 			}
 		}
 
-		srcline := readFile(filepath.Join(opt.ConfigPath, common.DirBuiltin, common.DirTemplates, opt.Template, common.HtmlTmplSrcSrcline))
+		srcline := tmpl.read(common.HtmlTmplSrcSrcline)
 		srcline = replaceTag(string(srcline), common.TagMarkerClass, markerCls)
 		var hasViolations string
 		vcnt := 0
@@ -158,15 +226,17 @@ func printReportBody(filename string, vcnt int, vmap map[int][]common.Violation)
 		fsrcline.WriteString(srcline + common.NewlineDefault)
 
 		if 0 < vcnt {
-			msglist := replaceTag(readFile(filepath.Join(opt.ConfigPath, common.DirBuiltin, common.DirTemplates, opt.Template, common.HtmlTmplSrcViolationMsglist)), common.TagLineNumber, fmt.Sprintf("%d", n))
+			msglist := replaceTag(tmpl.read(common.HtmlTmplSrcViolationMsglist), common.TagLineNumber, fmt.Sprintf("%d", n))
 
 			pathDetailMsg := pathDetail + ".msg.tmp"
 			fmsg, _ := os.OpenFile(pathDetailMsg, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 			defer fmsg.Close()
-			msgTmpl := readFile(filepath.Join(opt.ConfigPath, common.DirBuiltin, common.DirTemplates, opt.Template, common.HtmlTmplSrcViolationMsg))
+			msgTmpl := tmpl.read(common.HtmlTmplSrcViolationMsg)
 			for i := range vs {
 				if !vs[i].Fixed {
 					msg := replaceTag(msgTmpl, common.TagViolationMsg, vs[i].Message)
+					msg = replaceTag(msg, common.TagLineNumber, fmt.Sprintf("%d", n))
+					msg = replaceTag(msg, common.TagColumn, fmt.Sprintf("%d", column(vs[i])))
 					fmsg.WriteString(msg + common.NewlineDefault)
 				}
 			}
@@ -184,7 +254,7 @@ func printReportBody(filename string, vcnt int, vmap map[int][]common.Violation)
 	fsrc.Close()
 	fsrcline.Close()
 
-	replaceTagInFile(pathDetail, common.TagSrclines, readFile(pathDetailSrcline))
+	l.replaceTagInFile(pathDetail, common.TagSrclines, readFile(pathDetailSrcline))
 	os.Remove(pathDetailSrcline)
 }
 
@@ -193,23 +263,41 @@ func readFile(filename string) string {
 	return string(content)
 }
 
+var (
+	tagRegexpsMu sync.Mutex
+	tagRegexps   = make(map[string]*regexp.Regexp)
+)
+
+// tagRegexp returns the compiled tag, which is compiled only once.
+func tagRegexp(tag string) *regexp.Regexp {
+	tagRegexpsMu.Lock()
+	defer tagRegexpsMu.Unlock()
+	exp, ok := tagRegexps[tag]
+	if !ok {
+		exp = regexp.MustCompile(tag)
+		tagRegexps[tag] = exp
+	}
+	return exp
+}
+
+// replaceTag replaces tag in s with repl.
+// repl is used literally since it may be the source code or the messages,
+// which may contain `$`.
 func replaceTag(s, tag, repl string) string {
-	exp, _ := regexp.Compile(tag)
-	return exp.ReplaceAllString(s, repl)
+	return tagRegexp(tag).ReplaceAllLiteralString(s, repl)
 }
 
-func replaceTagInFile(filename, tag, repl string) {
+func (l *Linter) replaceTagInFile(filename, tag, repl string) {
 	fin, _ := os.Open(filename)
 	defer fin.Close()
 	ftmp, _ := os.OpenFile(filename+".tmp", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	defer ftmp.Close()
 
-	r := bufio.NewReaderSize(fin, common.BufSize)
+	r := bufio.NewReaderSize(fin, l.bufSize())
 	for n := 1; true; n++ {
 		line, _, err := readLine(r)
 
-		tagRegexp, _ := regexp.Compile(tag)
-		line = tagRegexp.ReplaceAllString(line, repl)
+		line = replaceTag(line, tag, repl)
 		ftmp.WriteString(line + common.NewlineDefault)
 
 		if err == io.EOF {
@@ -229,106 +317,51 @@ func readLine(r *bufio.Reader) (line string, isPrefix bool, err error) {
 	return
 }
 
-func finishReportFiles() {
+func (l *Linter) finishReportFiles() {
+	opt := l.opt
 	if opt.Html == "" {
 		return
 	}
-	replaceTagInFile(filepath.Join(opt.Html, common.HtmlIndex), common.TagSrclist, readFile(filepath.Join(opt.Html, common.HtmlTmplIndexSrclist)))
+	l.replaceTagInFile(filepath.Join(opt.Html, common.HtmlIndex), common.TagSrclist, readFile(filepath.Join(opt.Html, common.HtmlTmplIndexSrclist)))
 	os.Remove(filepath.Join(opt.Html, common.HtmlTmplIndexSrclist))
 }
 
-func dirExists(path string) error {
-	if _, err := os.Stat(path); err != nil && os.IsNotExist(err) {
-		return err
-	}
-	return nil
+// SetBaseline sets the baseline of the violations not to be reported by Lint.
+// b may be nil to report all the violations.
+func (l *Linter) SetBaseline(b *Baseline) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.baseline = b
 }
-func LoadConfig() (err error) {
-	// Get config directory(.fint)
-	pathConfig := opt.ConfigPath
-	if err = dirExists(pathConfig); err != nil {
-		return
-	}
-
-	// Get target ID directory
-	pathTarget := filepath.Join(pathConfig, common.DirBuiltin, common.DirTargets, opt.Id)
-	if err = dirExists(pathTarget); err != nil {
-		return common.NewError("no matching target to [" + opt.Id + "]")
-	}
-
-	// Get modules directory
-	pathModules := filepath.Join(pathConfig, common.DirBuiltin, common.DirModules)
-	if err = dirExists(pathModules); err != nil {
-		return common.NewError("modules directory not found in [" + pathModules + "]")
-	}
-
-	// Load .fint/builtin/modules/*/config.json
-	config = new(common.Config)
-	filesModules, _ := ioutil.ReadDir(pathModules)
-	for i := range filesModules {
-		entry := filesModules[i]
-		if entry.IsDir() {
-			// entry name is the name of module
-			entryPath := filepath.Join(pathModules, entry.Name())
-			var configBytes []byte
-			configBytes, err = ioutil.ReadFile(filepath.Join(entryPath, common.FileConfig))
-			if err != nil {
-				return
-			}
 
-			var c common.ModuleConfig
-			json.Unmarshal(configBytes, &c)
-
-			// Set name as Id to be searchable
-			c.Id = entry.Name()
-			config.ModuleConfigs = append(config.ModuleConfigs, c)
-		}
-	}
-
-	// Load target ruleset
-	var configBytes []byte
-	configBytes, err = ioutil.ReadFile(filepath.Join(pathTarget, common.FileRuleSet))
-	if err != nil {
-		return common.NewError("no matching target to [" + opt.Id + "]")
-	}
-	var target common.Target
-	json.Unmarshal(configBytes, &target)
-	config.Targets = append(config.Targets, target)
-
-	// Load target locales
-	filesTargetLocales, _ := ioutil.ReadDir(filepath.Join(pathTarget, common.DirLocales))
-	for i := range filesTargetLocales {
-		entry := filesTargetLocales[i]
-		locale := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
-
-		// Get contents of en.json, ja.json, ...
-		var configBytes []byte
-		configBytes, _ = ioutil.ReadFile(filepath.Join(pathTarget, common.DirLocales, entry.Name()))
-
-		var lt common.LocalizedTarget
-		json.Unmarshal(configBytes, &lt)
-
-		for i := range target.RuleSets {
-			for j := range target.RuleSets[i].Modules {
-				for k := range target.RuleSets[i].Modules[j].Rules {
-					// Pass all localized messages for each rules
-					if target.RuleSets[i].Modules[j].Rules[k].Message == nil {
-						target.RuleSets[i].Modules[j].Rules[k].Message = make(map[string]string)
-					}
-					target.RuleSets[i].Modules[j].Rules[k].Message[locale] = lt.RuleSets[i].Modules[j].Rules[k].Message
-				}
-			}
-		}
+// LoadConfig loads the configuration for the options of the Linter.
+func (l *Linter) LoadConfig() (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var c *common.Config
+	if c, err = LoadConfig(l.opt); err != nil {
+		return
 	}
+	l.config = c
 	return
 }
 
+// Setbufsize sets the default buffer size used for reading source files
+// when common.Opt.BufSize is not set.
+//
+// Deprecated: The size is shared by all the Linters in the process
+// and must not be changed while linting. Use common.Opt.BufSize instead.
 func Setbufsize(size int) {
 	if 0 < size {
 		common.BufSize = size
 	}
 }
 
+// bufSize returns the buffer size used for reading files.
+func (l *Linter) bufSize() int {
+	return modules.BufSize(l.opt.BufSize)
+}
+
 func pluralize(value int, singular, plural string) string {
 	if value < 2 {
 		return singular
@@ -336,7 +369,11 @@ func pluralize(value int, singular, plural string) string {
 	return plural
 }
 
-func MkReportDir(whenNotExist bool) (err error) {
+// MkReportDir creates the HTML report directory.
+// If whenNotExist is false, an existing directory is removed
+// when the force option is set, otherwise an error is returned.
+func (l *Linter) MkReportDir(whenNotExist bool) (err error) {
+	opt := l.opt
 	if opt.Html == "" {
 		return
 	}
@@ -352,42 +389,19 @@ func MkReportDir(whenNotExist bool) (err error) {
 	return
 }
 
-func Lint(srcRoot string) (err error) {
-	target := config.Targets[0]
-	allmap := make(map[string]map[int][]common.Violation)
-	var allv []common.Violation
-	var fmap map[string]map[int][]common.Violation
-	for i := range target.RuleSets {
-		// Lint with each modules
-		rs := target.RuleSets[i]
-		for j := range rs.Modules {
-			switch rs.Modules[j].Id {
-			case "pattern_match":
-				fmap, err = modules.LintWalk(srcRoot, rs.Modules[j], opt.Locale, opt.Fix, modules.LintPatternMatchFunc)
-			case "indent":
-				fmap, err = modules.LintWalk(srcRoot, rs.Modules[j], opt.Locale, opt.Fix, modules.LintIndentFunc)
-			case "max_length":
-				fmap, err = modules.LintWalk(srcRoot, rs.Modules[j], opt.Locale, opt.Fix, modules.LintMaxLengthFunc)
-			}
-			if err != nil {
-				return
-			}
-			// Merge into one map
-			if fmap != nil {
-				for f, vmap := range fmap {
-					if allmap[f] == nil {
-						allmap[f] = make(map[int][]common.Violation)
-					}
-					for n, vs := range vmap {
-						allmap[f][n] = append(allmap[f][n], vs...)
-						allv = append(allv, vs...)
-					}
-				}
-			}
-		}
-	}
-	violations = allv
-	for f, vmap := range allmap {
+// Report generates the HTML report of the last Lint.
+// It does nothing if the HTML report directory is not specified.
+func (l *Linter) Report() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.printReportHeader()
+	var files []string
+	for f := range l.results {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	for _, f := range files {
+		vmap := l.results[f]
 		vcnt := 0
 		for _, vs := range vmap {
 			vvcnt := 0
@@ -398,17 +412,38 @@ func Lint(srcRoot string) (err error) {
 			}
 			vcnt = vcnt + vvcnt
 		}
-		printReportBody(f, vcnt, vmap)
+		l.printReportBody(f, vcnt, vmap)
 	}
-	return
+	l.finishReportFiles()
 }
 
-func Execute(o *common.Opt) (v []common.Violation, err error) {
-	// Clear global vars
-	violations = []common.Violation{}
-	common.BufSize = 0
+// Violations returns the violations found by the last Lint.
+func (l *Linter) Violations() []common.Violation {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.violations
+}
+
+// Patch returns the unified diff of the fixes of the last Lint with DryRun.
+func (l *Linter) Patch() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return strings.Join(l.patches, "")
+}
 
-	if o.SrcRoot == "" {
+// execute lints the source files with the options o.
+// When linting stdin, the fixed lines are returned.
+func execute(o *common.Opt) (l *Linter, fixed []string, err error) {
+	if o.Stdin {
+		if o.StdinFilename == "" {
+			err = common.NewError("file name of stdin is required.")
+			return
+		}
+		if o.Html != "" {
+			err = common.NewError("HTML report is not supported for stdin.")
+			return
+		}
+	} else if o.SrcRoot == "" {
 		err = common.NewError("source directory is required.")
 		return
 	}
@@ -416,60 +451,203 @@ func Execute(o *common.Opt) (v []common.Violation, err error) {
 		err = common.NewError("ID of the rule set is required.")
 		return
 	}
-	opt = o
-	err = MkReportDir(false)
-	if err != nil {
+	if o.DryRun && !o.Fix {
+		err = common.NewError("dry run is only available with fix.")
 		return
 	}
-
-	if opt.ConfigPath == "" {
-		err = common.NewError("config directory is required.")
+	if o.DryRun && o.Html != "" {
+		// Violations are in the fixed lines which are not written
+		err = common.NewError("HTML report is not supported for dry run.")
+		return
+	}
+	if o.Staged && (o.Fix || o.Html != "") {
+		// The staged content may differ from the files
+		err = common.NewError("fix and HTML report are not supported for staged changes.")
+		return
+	}
+	l = NewLinter(o, nil)
+	err = l.MkReportDir(false)
+	if err != nil {
 		return
 	}
 
-	err = LoadConfig()
+	err = l.LoadConfig()
 	if err != nil {
 		return
 	}
 
-	printReportHeader()
+	if o.Baseline != "" {
+		var b *Baseline
+		if b, err = ReadBaseline(o.Baseline); err != nil {
+			return
+		}
+		l.SetBaseline(b)
+	}
+
+	if o.Stdin {
+		fixed, err = l.LintReader(os.Stdin, o.StdinFilename)
+	} else {
+		err = l.Lint(o.SrcRoot)
+	}
 
-	err = Lint(opt.SrcRoot)
+	l.Report()
 
-	finishReportFiles()
+	return
+}
 
-	return violations, err
+// Execute lints the source files with the options o and returns the violations.
+func Execute(o *common.Opt) (v []common.Violation, err error) {
+	v = []common.Violation{}
+	l, _, err := execute(o)
+	if l != nil && l.Violations() != nil {
+		v = l.Violations()
+	}
+	return
 }
 
+// ExecuteAsCommand lints the source files with the options o and prints the violations.
+// It returns an error if any violation is as severe as o.FailOn.
+// When fixing stdin or with o.DryRun, the fixed content or the unified diff
+// is printed to stdout and the violations to stderr.
 func ExecuteAsCommand(o *common.Opt) (err error) {
-	term = os.Getenv("TERM")
-	_, err = Execute(o)
+	term := os.Getenv("TERM")
+	var out io.Writer = os.Stdout
+	if o.Stdin && o.Fix || o.DryRun {
+		out = os.Stderr
+	}
+	if o.Verbose && !o.Quiet {
+		printConfig(out, o, o.Id)
+	}
+	failOn, ok := common.SeverityLevel(o.FailOn)
+	var l *Linter
+	var fixed []string
+	if !ok {
+		err = common.NewError("invalid severity [" + o.FailOn + "] for fail-on.")
+	} else {
+		l, fixed, err = execute(o)
+	}
 	if err != nil {
 		if !o.Quiet {
-			fmt.Println(err)
+			fmt.Fprintln(out, err)
 		}
 		return
 	}
+	if o.DryRun {
+		fmt.Print(l.Patch())
+	} else if o.Stdin && o.Fix {
+		fmt.Print(strings.Join(fixed, common.Linefeed))
+	}
+	violations := l.Violations()
 	if !o.Quiet {
 		for i := range violations {
 			if !violations[i].Fixed {
-				printViolation(violations[i])
+				printViolation(out, term, violations[i], o.ShowRuleId)
 			}
 		}
 	}
 
-	vcnt := 0
+	// Count unfixed violations by severity
+	counts := make(map[string]int)
+	failed := false
 	for i := range violations {
 		if !violations[i].Fixed {
-			vcnt++
+			counts[violations[i].Severity]++
+			if level, _ := common.SeverityLevel(violations[i].Severity); 0 < failOn && failOn <= level {
+				failed = true
+			}
 		}
 	}
-	if 0 < vcnt {
-		if !o.Quiet {
-			fmt.Printf("\n%d %s generated.\n",
-				vcnt, pluralize(vcnt, "warning", "warnings"))
-		}
+	if 0 < len(counts) && !o.Quiet {
+		fmt.Fprintf(out, "\n%s generated.\n", summarize(counts))
+	}
+	if failed {
 		err = common.NewError("error while executing lint")
 	}
 	return
 }
+
+// summarize returns the numbers of the violations like "1 error and 2 warnings".
+func summarize(counts map[string]int) string {
+	var parts []string
+	for _, s := range []struct{ severity, singular, plural string }{
+		{common.SeverityError, "error", "errors"},
+		{common.SeverityWarning, "warning", "warnings"},
+		{common.SeverityInfo, "note", "notes"}} {
+		if n := counts[s.severity]; 0 < n {
+			parts = append(parts, fmt.Sprintf("%d %s", n, pluralize(n, s.singular, s.plural)))
+		}
+	}
+	if len(parts) < 2 {
+		return strings.Join(parts, "")
+	}
+	return strings.Join(parts[:len(parts)-1], ", ") + " and " + parts[len(parts)-1]
+}
+
+// WriteBaseline lints the source files with the options o and writes
+// all the violations to the baseline file o.Baseline,
+// or common.FileBaseline if o.Baseline is empty.
+func WriteBaseline(o *common.Opt) (b *Baseline, err error) {
+	opt := *o
+	opt.Baseline = ""
+	opt.Fix = false
+	opt.DryRun = false
+	opt.ReportUnusedSuppressions = false
+	opt.ReportUnusedBaseline = false
+	var l *Linter
+	if l, _, err = execute(&opt); err != nil {
+		return
+	}
+	b = NewBaseline(l.Violations())
+	err = b.Write(baselineFile(o))
+	return
+}
+
+func baselineFile(o *common.Opt) string {
+	if o.Baseline == "" {
+		return common.FileBaseline
+	}
+	return o.Baseline
+}
+
+// BaselineAsCommand writes the baseline file with the options o
+// and prints the number of the violations.
+func BaselineAsCommand(o *common.Opt) (err error) {
+	b, err := WriteBaseline(o)
+	if o.Quiet {
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	n := 0
+	for i := range b.Violations {
+		n += b.Violations[i].Count
+	}
+	fmt.Printf("%d %s written to %s.\n", n, pluralize(n, "violation", "violations"), baselineFile(o))
+	return
+}
+
+// ValidateAsCommand checks the config files with the options o and prints the problems.
+// It returns an error if any problem is found.
+func ValidateAsCommand(o *common.Opt) (err error) {
+	if o.Verbose && !o.Quiet {
+		id := o.Id
+		if id == "" {
+			id = common.TargetIdAll
+		}
+		printConfig(os.Stdout, o, id)
+	}
+	var problems []Problem
+	if problems, err = Validate(o); err == nil && 0 < len(problems) {
+		err = &ValidationError{Problems: problems}
+	}
+	if err != nil && !o.Quiet {
+		fmt.Println(err)
+		if ve, ok := err.(*ValidationError); ok {
+			fmt.Printf("\n%d %s found.\n",
+				len(ve.Problems), pluralize(len(ve.Problems), "problem", "problems"))
+		}
+	}
+	return
+}
@@ -21,8 +21,16 @@ func main() {
 		common.PrintUsage()
 		os.Exit(ExitCodeError)
 	}
+	args := os.Args[2:]
 	switch os.Args[1] {
-	case "run":
+	case "run", "validate", "baseline", "list-targets", "init":
+	case "locales":
+		// Only check is available for now
+		if len(os.Args) < 3 || os.Args[2] != "check" {
+			common.PrintUsage()
+			os.Exit(ExitCodeError)
+		}
+		args = os.Args[3:]
 	case "version":
 		common.PrintVersion()
 		os.Exit(ExitCodeSuccess)
@@ -36,29 +44,67 @@ func main() {
 	// Parse flags
 	var (
 		srcRoot    = flag.String("s", "", "Source directory to be checked. Required.")
-		configPath = flag.String("c", ".fint", "Config files directory. Default value is `.fint`.")
-		locale     = flag.String("l", "en", "Message locale. Default value is `en`(English). Currently, `en` and `ja` is supported.")
+		configPath = flag.String("c", "", "Config files directory. Default is the nearest `.fint` searched upward from `-s`, otherwise the embedded config is used.")
+		locale     = flag.String("l", "", "Message locale. Default is detected from `LC_ALL`, `LC_MESSAGES` and `LANG`, or `en`(English). Currently, `en` and `ja` is supported.")
 		id         = flag.String("i", "", "ID of the target rule sets. Required.")
 		html       = flag.String("h", "", "HTML report directory. Optional.")
 		force      = flag.Bool("f", false, "Force generating report to existing directory. Default is `false`.")
 		quiet      = flag.Bool("q", false, "Quiet mode. Suppresses output. Default is `false`.")
 		template   = flag.String("template", "default", "HTML report template name. Default is `default`.")
 		fix        = flag.Bool("fix", false, "Fix violations. Default is `false`.")
+		dryRun     = flag.Bool("dry-run", false, "Print the fixes as a unified diff without writing files. Used with `-fix`. Default is `false`.")
+		jobs       = flag.Int("j", 0, "Number of files linted in parallel. Default is the number of CPUs.")
+		showRuleId = flag.Bool("rule-id", false, "Show rule ID of violations. Default is `false`.")
+		unusedSups = flag.Bool("unused-suppressions", false, "Report unused suppression comments. Default is `false`.")
+		baseline   = flag.String("baseline", "", "Baseline file of the violations not to be reported. Optional.")
+		unusedBase = flag.Bool("unused-baseline", false, "Report baseline entries which no longer occur. Default is `false`.")
+		diffBase   = flag.String("diff-base", "", "Report only violations in lines changed from the git revision. Optional.")
+		staged     = flag.Bool("staged", false, "Report only violations in lines staged in git. Default is `false`.")
+		stdin      = flag.Bool("stdin", false, "Lint source from stdin instead of `-s`. Default is `false`.")
+		stdinName  = flag.String("stdin-filename", "", "File name of the source from stdin to select modules. Required with `-stdin`.")
+		failOn     = flag.String("fail-on", "warning", "Lowest severity to fail: error, warning, info or off. Default is `warning`.")
+		verbose    = flag.Bool("verbose", false, "Print the config directory and the targets in use. Default is `false`.")
 	)
 	// Parse without filename and command
-	flag.CommandLine.Parse(os.Args[2:])
+	flag.CommandLine.Parse(args)
 
-	err := fint.ExecuteAsCommand(
-		&common.Opt{
-			SrcRoot:    *srcRoot,
-			ConfigPath: *configPath,
-			Locale:     *locale,
-			Id:         *id,
-			Html:       *html,
-			Force:      *force,
-			Quiet:      *quiet,
-			Template:   *template,
-			Fix:        *fix})
+	opt := &common.Opt{
+		SrcRoot:                  *srcRoot,
+		ConfigPath:               *configPath,
+		Locale:                   *locale,
+		Id:                       *id,
+		Html:                     *html,
+		Force:                    *force,
+		Quiet:                    *quiet,
+		Template:                 *template,
+		Fix:                      *fix,
+		DryRun:                   *dryRun,
+		Jobs:                     *jobs,
+		ShowRuleId:               *showRuleId,
+		FailOn:                   *failOn,
+		ReportUnusedSuppressions: *unusedSups,
+		Baseline:                 *baseline,
+		ReportUnusedBaseline:     *unusedBase,
+		DiffBase:                 *diffBase,
+		Staged:                   *staged,
+		Stdin:                    *stdin,
+		StdinFilename:            *stdinName,
+		Verbose:                  *verbose}
+	var err error
+	switch os.Args[1] {
+	case "validate":
+		err = fint.ValidateAsCommand(opt)
+	case "baseline":
+		err = fint.BaselineAsCommand(opt)
+	case "list-targets":
+		err = fint.ListTargetsAsCommand(opt)
+	case "init":
+		err = fint.InitAsCommand(opt)
+	case "locales":
+		err = fint.CheckLocalesAsCommand(opt)
+	default:
+		err = fint.ExecuteAsCommand(opt)
+	}
 	if err != nil {
 		os.Exit(ExitCodeError)
 	}
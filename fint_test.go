@@ -4,19 +4,34 @@
 package fint_test
 
 import (
+	"fmt"
 	"github.com/ksoichiro/fint"
 	"github.com/ksoichiro/fint/common"
 	"github.com/ksoichiro/fint/modules"
+	"io/ioutil"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 const (
+	EnvXdgConfigHome          = "XDG_CONFIG_HOME"
 	EnvTerm                   = "TERM"
 	SrcRootObjcNormal         = "testdata/objc/FintExample"
 	SrcRootObjcEmpty          = "testdata/objc/FintExample_Empty"
 	SrcRootObjcSingleError    = "testdata/objc/FintExample_SingleError"
 	SrcRootObjcSymlink        = "testdata/objc/link"
+	SrcRootObjcColumns        = "testdata/objc/FintExample_Columns"
+	SrcRootObjcSuppress       = "testdata/objc/FintExample_Suppress"
+	SrcRootObjcIgnore         = "testdata/objc/FintExample_Ignore"
+	SrcRootMixed              = "testdata/mixed"
 	SrcSingleFile             = "testdata/objc/FintExample/FintExample/FEAppDelegate.m"
 	SrcNonExistent            = "testdata/non_existent_file"
 	SrcMatchingButNonExistent = "testdata/non_existent_file.m"
@@ -27,6 +42,15 @@ const (
 	ConfigNoModules           = "testdata/config/no_module"
 	ConfigNoModuleConfig      = "testdata/config/no_module_config"
 	ConfigNoTarget            = "testdata/config/no_target"
+	ConfigModules             = "testdata/config/modules"
+	ConfigExternal            = "testdata/config/external"
+	ConfigInvalid             = "testdata/config/invalid"
+	ConfigSeverity            = "testdata/config/severity"
+	ConfigExtends             = "testdata/config/extends"
+	ConfigLayers              = "testdata/config/layers"
+	ConfigLocales             = "testdata/config/locales"
+	ConfigLayersUser          = "testdata/config/layers_user"
+	ConfigFix                 = "testdata/config/fix"
 	LintIdObjc                = "objc"
 	LocaleDefault             = "en"
 	LocaleJa                  = "ja"
@@ -34,6 +58,25 @@ const (
 	ErrorsObjcNormal          = 68
 )
 
+func TestMain(m *testing.M) {
+	// Tests should not read the user config of the developer
+	userConfig, ok := os.LookupEnv(EnvXdgConfigHome)
+	dir, err := ioutil.TempDir("", "fint_user_config")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	os.Setenv(EnvXdgConfigHome, dir)
+	code := m.Run()
+	if ok {
+		os.Setenv(EnvXdgConfigHome, userConfig)
+	} else {
+		os.Unsetenv(EnvXdgConfigHome)
+	}
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func TestExecuteAsCommand(t *testing.T) {
 	var err error
 
@@ -67,10 +110,41 @@ func TestExecute(t *testing.T) {
 	testExecuteNormal(t, &common.Opt{SrcRoot: SrcRootObjcSymlink, ConfigPath: ConfigDefault, Locale: LocaleJa, Id: LintIdObjc}, ErrorsObjcNormal)
 }
 
+func TestReportLiteral(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "fint_report")
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "config")
+	fint.CopyDir(ConfigLocales, config)
+	ioutil.WriteFile(filepath.Join(config, "builtin/targets/objc/locales/en.json"), []byte(`{"rulesets": [{"id": "ObjectiveCSource", "modules": [
+  {"id": "pattern_match", "rules": [{"id": "WhitespaceAfterComma", "message": "{match} in {file}"}]}]}]}`), 0666)
+	src := filepath.Join(dir, "src")
+	os.MkdirAll(src, 0777)
+	ioutil.WriteFile(filepath.Join(src, "a$1.m"), []byte("int ${x},a$1;\n"), 0666)
+	report := filepath.Join(dir, "report")
+
+	// Source code, file names and messages should be written as they are.
+	testExecuteNormal(t, &common.Opt{SrcRoot: src, ConfigPath: config, Locale: LocaleDefault, Id: LintIdObjc, Html: report, Template: TemplateDefault, Force: true}, 1)
+	file := filepath.Join(src, "a$1.m")
+	index, _ := ioutil.ReadFile(filepath.Join(report, "index.html"))
+	detail, _ := ioutil.ReadFile(filepath.Join(report, "src", file+".html"))
+	for _, c := range []struct {
+		content  []byte
+		expected string
+	}{
+		{index, file},
+		{detail, file},
+		{detail, "int ${x},a$1;"},
+		{detail, ", in " + file},
+	} {
+		if !strings.Contains(string(c.content), c.expected) {
+			t.Errorf("Expected [%s] in the report but was [%s]", c.expected, c.content)
+		}
+	}
+}
+
 func TestExecuteError(t *testing.T) {
 	testExecuteError(t, &common.Opt{SrcRoot: "", ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc}, "fint: source directory is required.")
 	testExecuteError(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: ""}, "fint: ID of the rule set is required.")
-	testExecuteError(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: "", Locale: LocaleDefault, Id: LintIdObjc}, "fint: config directory is required.")
 	testExecuteError(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: "foo"}, "fint: no matching target to [foo]")
 	testExecuteNormalWithReport(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Html: TestReportDir, Template: TemplateDefault, Force: true}, ErrorsObjcNormal, true, false)
 	testExecuteErrorWithReport(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Html: TestReportDir, Template: TemplateDefault},
@@ -79,7 +153,1108 @@ func TestExecuteError(t *testing.T) {
 	testExecuteError(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigNonExistent, Locale: LocaleDefault, Id: LintIdObjc}, "stat non_existent_dir: no such file or directory")
 	testExecuteError(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigNoModules, Locale: LocaleDefault, Id: LintIdObjc}, "fint: modules directory not found in [testdata/config/no_module/builtin/modules]")
 	testExecuteError(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigNoModuleConfig, Locale: LocaleDefault, Id: LintIdObjc}, "open testdata/config/no_module_config/builtin/modules/pattern_match/config.json: no such file or directory")
-	testExecuteError(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigNoTarget, Locale: LocaleDefault, Id: LintIdObjc}, "fint: no matching target to ["+LintIdObjc+"]")
+	testExecuteError(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigNoTarget, Locale: LocaleDefault, Id: "foo"}, "fint: no matching target to [foo]")
+	testExecuteError(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigModules, Locale: LocaleDefault, Id: "invalid_pattern"},
+		"fint: testdata/config/modules/builtin/targets/invalid_pattern/ruleset.json: rulesets[0].modules[0].rules[1].args[0]: invalid pattern [foo(] in rule [Broken] of module [pattern_match] in rule set [InvalidPattern] of target [invalid_pattern]: error parsing regexp: missing closing ): `foo(`")
+	testExecuteError(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigModules, Locale: LocaleDefault, Id: "invalid_file_pattern"},
+		"fint: testdata/config/modules/builtin/targets/invalid_file_pattern/ruleset.json: rulesets[0].modules[0].pattern: invalid pattern [*.m] of module [pattern_match] in rule set [InvalidFilePattern] of target [invalid_file_pattern]: error parsing regexp: missing argument to repetition operator: `*`")
+}
+
+func TestLinter(t *testing.T) {
+	// Linters should not share their state even if they run at the same time.
+	srcs := []string{SrcRootObjcNormal, SrcRootObjcSingleError, SrcRootObjcEmpty, SrcRootObjcNormal}
+	expected := []int{ErrorsObjcNormal, 1, 0, ErrorsObjcNormal}
+	counts := make([]int, len(srcs))
+	var wg sync.WaitGroup
+	for i := range srcs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			opt := &common.Opt{SrcRoot: srcs[i], ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc}
+			c, err := fint.LoadConfig(opt)
+			if err != nil {
+				t.Errorf("Unexpected error occurred: %v", err)
+				return
+			}
+			l := fint.NewLinter(opt, c)
+			if err = l.Lint(opt.SrcRoot); err != nil {
+				t.Errorf("Unexpected error occurred: %v", err)
+				return
+			}
+			counts[i] = len(l.Violations())
+		}(i)
+	}
+	wg.Wait()
+	for i := range srcs {
+		if counts[i] != expected[i] {
+			t.Errorf("Expected violations for [%s] are [%d] but [%d] found", srcs[i], expected[i], counts[i])
+		}
+	}
+
+	// Lint without loading config should fail.
+	l := fint.NewLinter(&common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc}, nil)
+	testExpectErrorWithMessage(t, l.Lint(SrcRootObjcNormal), "fint: config is not loaded.")
+	testExpectSuccess(t, l.LoadConfig())
+	testExpectSuccess(t, l.Lint(SrcRootObjcNormal))
+	if len(l.Violations()) != ErrorsObjcNormal {
+		t.Errorf("Expected violations are [%d] but [%d] found", ErrorsObjcNormal, len(l.Violations()))
+	}
+}
+
+type firstLineModule struct{}
+
+func (firstLineModule) Lint(m common.Module, filename string, lines []string, locale string, shouldFix bool) (vmap map[int][]common.Violation, fixed []string, err error) {
+	vmap = make(map[int][]common.Violation)
+	vmap[1] = []common.Violation{common.Violation{Filename: filename, Line: 1, Message: m.Rules[0].Message[locale]}}
+	return
+}
+
+func TestModuleRegistry(t *testing.T) {
+	modules.Register("test_first_line", firstLineModule{})
+	if _, ok := modules.Lookup("test_first_line"); !ok {
+		t.Errorf("Expected module is not registered")
+	}
+	for _, id := range []string{"pattern_match", "indent", "max_length"} {
+		if _, ok := modules.Lookup(id); !ok {
+			t.Errorf("Expected builtin module [%s] is not registered", id)
+		}
+	}
+
+	// Modules registered outside of fint should be used by rule sets.
+	// Builtin modules which are not registered should be ignored unless they are used.
+	testExecuteNormal(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigModules, Locale: LocaleDefault, Id: "registry"}, 4)
+	problems, err := fint.Validate(&common.Opt{ConfigPath: ConfigModules, Id: "registry"})
+	testExpectSuccess(t, err)
+	if len(problems) != 0 {
+		t.Errorf("Expected no problems but found %v", problems)
+	}
+
+	// Rule sets using unknown modules should not be loaded.
+	testExecuteError(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigModules, Locale: LocaleDefault, Id: "unregistered"},
+		"fint: testdata/config/modules/builtin/targets/unregistered/ruleset.json: rulesets[0].modules[0].id: module [non_existent_module] used in rule set [Unregistered] of target [unregistered] is not registered")
+	testExecuteError(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigModules, Locale: LocaleDefault, Id: "stale"},
+		"fint: testdata/config/modules/builtin/targets/stale/ruleset.json: rulesets[0].modules[0].id: builtin module [stale_module] used in rule set [Stale] of target [stale] is not registered")
+}
+
+func TestExternalModule(t *testing.T) {
+	// Violations returned from external modules should have localized messages.
+	v, err := fint.Execute(&common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigExternal, Locale: LocaleDefault, Id: "external"})
+	testExpectSuccess(t, err)
+	if len(v) != 4 {
+		t.Errorf("Expected violations are [%d] but [%d] found", 4, len(v))
+	}
+	for i := range v {
+		if v[i].Line != 1 || v[i].Message != "First line of the file" {
+			t.Errorf("Unexpected violation: %v", v[i])
+		}
+	}
+
+	// Failure of external modules should stop lint.
+	testExecuteError(t, &common.Opt{SrcRoot: SrcSingleFile, ConfigPath: ConfigExternal, Locale: LocaleDefault, Id: "external_failure"},
+		"fint: external module [failure] failed for "+SrcSingleFile+": exit status 3: something went wrong")
+
+	// External modules should be stopped after the timeout.
+	start := time.Now()
+	testExecuteError(t, &common.Opt{SrcRoot: SrcSingleFile, ConfigPath: ConfigExternal, Locale: LocaleDefault, Id: "external_timeout"},
+		"fint: external module [slow] timed out after 100ms for "+SrcSingleFile)
+	if elapsed := time.Since(start); 5*time.Second < elapsed {
+		t.Errorf("Expected external module to be stopped but it took %v", elapsed)
+	}
+
+	// Invalid responses should stop lint.
+	for _, c := range []struct{ id, expected string }{
+		{"external_invalid_json", "fint: external module [invalid_json] returned invalid response for " + SrcSingleFile + ": invalid character 'o' in literal null (expecting 'u')"},
+		{"external_invalid_line", "fint: external module [invalid_line] returned invalid line 10000 for " + SrcSingleFile},
+		{"external_unknown_rule", "fint: external module [unknown_rule] returned unknown rule [Unknown] for " + SrcSingleFile},
+	} {
+		testExecuteError(t, &common.Opt{SrcRoot: SrcSingleFile, ConfigPath: ConfigExternal, Locale: LocaleDefault, Id: c.id}, c.expected)
+	}
+
+	// Columns and params of the violations should be used.
+	dir := "testdata_external"
+	os.RemoveAll(dir)
+	os.Mkdir(dir, 0777)
+	defer os.RemoveAll(dir)
+	src := filepath.Join(dir, "A.m")
+	ioutil.WriteFile(src, []byte("int a,b;\nint c;\n"), 0666)
+	opt := &common.Opt{SrcRoot: dir, ConfigPath: ConfigExternal, Locale: LocaleDefault, Id: "external_fix"}
+	v, err = fint.Execute(opt)
+	testExpectSuccess(t, err)
+	if len(v) != 1 || v[0].Line != 1 || v[0].Column != 6 || v[0].EndColumn != 7 || v[0].Message != "Space must be inserted after ',' in a,b of Comma" {
+		t.Errorf("Unexpected violations: %v", v)
+	}
+
+	// Fixes of external modules should be previewed and written.
+	opt.Fix, opt.DryRun = true, true
+	l := fint.NewLinter(opt, nil)
+	testExpectSuccess(t, l.LoadConfig())
+	testExpectSuccess(t, l.Lint(dir))
+	if expected := "--- a/testdata_external/A.m\n+++ b/testdata_external/A.m\n@@ -1,2 +1,2 @@\n-int a,b;\n+int a, b;\n int c;\n"; l.Patch() != expected {
+		t.Errorf("Expected patch is [%s] but was [%s]", expected, l.Patch())
+	}
+	opt.DryRun = false
+	v, err = fint.Execute(opt)
+	testExpectSuccess(t, err)
+	if len(v) != 0 {
+		t.Errorf("Expected no violations after fixing but were %v", v)
+	}
+	if b, _ := ioutil.ReadFile(src); string(b) != "int a, b;\nint c;\n" {
+		t.Errorf("Expected fixed content but was [%s]", b)
+	}
+}
+
+func TestLintJobs(t *testing.T) {
+	// Results should not depend on the number of the workers.
+	expected, _ := fint.Execute(&common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Jobs: 1})
+	for _, jobs := range []int{0, 2, 16} {
+		v, _ := fint.Execute(&common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Jobs: jobs})
+		if !reflect.DeepEqual(v, expected) {
+			t.Errorf("Violations with [%d] jobs differ from violations with 1 job", jobs)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// Builtin config should be valid.
+	problems, err := fint.Validate(&common.Opt{ConfigPath: ConfigDefault})
+	testExpectSuccess(t, err)
+	if len(problems) != 0 {
+		t.Errorf("Expected no problems but found %v", problems)
+	}
+	testExpectSuccess(t, fint.ValidateAsCommand(&common.Opt{ConfigPath: ConfigDefault, Id: LintIdObjc}))
+
+	// All the problems should be reported with their locations.
+	problems, err = fint.Validate(&common.Opt{ConfigPath: ConfigInvalid})
+	testExpectSuccess(t, err)
+	expected := []string{
+		ConfigInvalid + "/builtin/modules/broken_external/config.json: executable: is required",
+		ConfigInvalid + "/builtin/modules/broken_external/config.json: timeout: must be a positive number",
+		ConfigInvalid + "/builtin/modules/max_length/config.json: timeout: is available only for external modules",
+		ConfigInvalid + "/builtin/targets/locale/locales/en.json: rulesets[0].modules[0].rules[1].message: is required",
+		ConfigInvalid + "/builtin/targets/locale/locales/en.json: rulesets[0].modules[0].rules[2].id: duplicate ID [TrailingWhitespace]",
+		ConfigInvalid + "/builtin/targets/objc/ruleset.json: rulesets[0].exclude[1]: invalid pattern [[z-a]]: error parsing regexp: invalid character class range: `z-a`",
+		ConfigInvalid + "/builtin/targets/objc/ruleset.json: rulesets[0].modules[0].rules[1].args[1]: argument [exclude] is required",
+		ConfigInvalid + "/builtin/targets/objc/ruleset.json: rulesets[0].modules[0].rules[2].id: duplicate ID [WhitespaceBeforeElse]",
+		ConfigInvalid + "/builtin/targets/objc/ruleset.json: rulesets[0].modules[0].rules[2].args[1]: argument [exclude] must be a string",
+		ConfigInvalid + "/builtin/targets/objc/ruleset.json: rulesets[0].modules[1].rules[0].severity: must be one of [error], [warning], [info] and [off] but was [fatal]",
+		ConfigInvalid + "/builtin/targets/objc/ruleset.json: rulesets[0].modules[1].rules[0].args[1]: argument [max] must be a number",
+		ConfigInvalid + "/builtin/targets/syntax/ruleset.json: line 3, column 21: invalid character '}' looking for beginning of object key string",
+	}
+	if len(problems) != len(expected) {
+		t.Errorf("Expected problems are [%d] but [%d] found: %v", len(expected), len(problems), problems)
+	} else {
+		for i := range expected {
+			if problems[i].String() != expected[i] {
+				t.Errorf("Expected problem [%s] but was [%s]", expected[i], problems[i].String())
+			}
+		}
+	}
+	testExpectError(t, fint.ValidateAsCommand(&common.Opt{ConfigPath: ConfigInvalid, Quiet: true}))
+
+	// Invalid config should not be used for lint.
+	_, err = fint.Execute(&common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigInvalid, Locale: LocaleDefault, Id: LintIdObjc})
+	if ve, ok := err.(*fint.ValidationError); !ok {
+		t.Errorf("Expected validation error but was [%v]", err)
+	} else if len(ve.Problems) != 9 {
+		t.Errorf("Expected problems are [%d] but [%d] found: %v", 9, len(ve.Problems), ve.Problems)
+	}
+}
+
+func TestViolationColumns(t *testing.T) {
+	v, _ := fint.Execute(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc})
+	expected := [][]int{
+		// Line, Column, EndColumn, Offset, EndOffset
+		[]int{1, 6, 7, 5, 6},       // ',' of `int a,b;`
+		[]int{2, 1, 2, 9, 10},      // Tab of indent
+		[]int{3, 81, 86, 101, 106}, // Characters over the limit
+		[]int{4, 1, 6, 107, 112},   // `}else` of `}else {`
+	}
+	if len(v) != len(expected) {
+		t.Fatalf("Expected violations are [%d] but [%d] found", len(expected), len(v))
+	}
+	for i := range expected {
+		actual := []int{v[i].Line, v[i].Column, v[i].EndColumn, v[i].Offset, v[i].EndOffset}
+		if !reflect.DeepEqual(actual, expected[i]) {
+			t.Errorf("Expected range is %v but was %v", expected[i], actual)
+		}
+	}
+
+	// Columns should be printed.
+	os.Setenv(EnvTerm, "dumb")
+	var err error
+	out := testCaptureStdout(t, func() {
+		err = fint.ExecuteAsCommand(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc})
+	})
+	testExpectError(t, err)
+	file := filepath.Join(SrcRootObjcColumns, "Columns.m")
+	expectedOut := file + ":1:6: warning: Space must be inserted after ','\n" +
+		file + ":2:1: warning: Use spaces for indentation instead of tab\n" +
+		file + ":3:81: warning: Line length 85 exceeds 80 characters\n" +
+		file + ":4:1: warning: Space must be inserted before else\n" +
+		"\n4 warnings generated.\n"
+	if out != expectedOut {
+		t.Errorf("Expected output is [%s] but was [%s]", expectedOut, out)
+	}
+}
+
+func TestViolationIds(t *testing.T) {
+	v, _ := fint.Execute(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc})
+	expected := [][]string{
+		// RuleId, ModuleId, RuleSetId, TargetId
+		[]string{"WhitespaceAfterComma", "pattern_match", "ObjectiveCSource", LintIdObjc},
+		[]string{"Whitespaces", "indent", "ObjectiveCSource", LintIdObjc},
+		[]string{"ExceedMaxLength", "max_length", "ObjectiveCSource", LintIdObjc},
+		[]string{"WhitespaceBeforeElse", "pattern_match", "ObjectiveCSource", LintIdObjc},
+	}
+	if len(v) != len(expected) {
+		t.Fatalf("Expected violations are [%d] but [%d] found", len(expected), len(v))
+	}
+	for i := range expected {
+		actual := []string{v[i].RuleId, v[i].ModuleId, v[i].RuleSetId, v[i].TargetId}
+		if !reflect.DeepEqual(actual, expected[i]) {
+			t.Errorf("Expected IDs are %v but were %v", expected[i], actual)
+		}
+	}
+
+	// Rule IDs should be printed only if required.
+	os.Setenv(EnvTerm, "dumb")
+	for _, showRuleId := range []bool{true, false} {
+		var err error
+		out := testCaptureStdout(t, func() {
+			err = fint.ExecuteAsCommand(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, ShowRuleId: showRuleId})
+		})
+		testExpectError(t, err)
+		lines := strings.Split(out, "\n")
+		if len(lines) < len(expected) {
+			t.Fatalf("Expected violations are printed but output was [%s]", out)
+		}
+		for i := range expected {
+			suffix := " [" + expected[i][0] + "]"
+			if strings.HasSuffix(lines[i], suffix) != showRuleId {
+				t.Errorf("Expected rule ID [%s] is printed only if required (%v) but was [%s]", expected[i][0], showRuleId, lines[i])
+			}
+		}
+	}
+}
+
+func TestSeverity(t *testing.T) {
+	v, err := fint.Execute(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigSeverity, Locale: LocaleDefault, Id: LintIdObjc})
+	testExpectSuccess(t, err)
+	// Rules with off severity should not be checked.
+	expected := [][]string{
+		[]string{"WhitespaceAfterComma", common.SeverityError},
+		[]string{"Whitespaces", common.SeverityInfo},
+		[]string{"WhitespaceBeforeElse", common.SeverityWarning},
+	}
+	if len(v) != len(expected) {
+		t.Fatalf("Expected violations are [%d] but [%d] found", len(expected), len(v))
+	}
+	for i := range expected {
+		actual := []string{v[i].RuleId, v[i].Severity}
+		if !reflect.DeepEqual(actual, expected[i]) {
+			t.Errorf("Expected severity is %v but was %v", expected[i], actual)
+		}
+	}
+
+	// Lint should fail only when any violation is as severe as FailOn.
+	os.Setenv(EnvTerm, "dumb")
+	for _, c := range []struct {
+		failOn string
+		fails  bool
+	}{
+		{"", true},
+		{common.SeverityError, true},
+		{common.SeverityWarning, true},
+		{common.SeverityInfo, true},
+		{common.SeverityOff, false},
+	} {
+		err = fint.ExecuteAsCommand(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigSeverity, Locale: LocaleDefault, Id: LintIdObjc, FailOn: c.failOn})
+		if c.fails {
+			testExpectError(t, err)
+		} else {
+			testExpectSuccess(t, err)
+		}
+	}
+
+	// Violations should be printed with the labels of the severities.
+	out := testCaptureStdout(t, func() {
+		err = fint.ExecuteAsCommand(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigSeverity, Locale: LocaleDefault, Id: LintIdObjc, FailOn: common.SeverityOff})
+	})
+	testExpectSuccess(t, err)
+	file := filepath.Join(SrcRootObjcColumns, "Columns.m")
+	expectedOut := file + ":1:6: error: Space must be inserted after ','\n" +
+		file + ":2:1: note: Use spaces for indentation instead of tab\n" +
+		file + ":4:1: warning: Space must be inserted before else\n" +
+		"\n1 error, 1 warning and 1 note generated.\n"
+	if out != expectedOut {
+		t.Errorf("Expected output is [%s] but was [%s]", expectedOut, out)
+	}
+	os.Setenv(EnvTerm, "xterm-256color")
+	testExpectSuccess(t, fint.ExecuteAsCommand(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigSeverity, Locale: LocaleDefault, Id: LintIdObjc, FailOn: common.SeverityOff}))
+
+	// Invalid severity should be an error.
+	testExpectErrorWithMessage(t, fint.ExecuteAsCommand(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigSeverity, Locale: LocaleDefault, Id: LintIdObjc, FailOn: "fatal", Quiet: true}),
+		"fint: invalid severity [fatal] for fail-on.")
+}
+
+func TestSuppression(t *testing.T) {
+	v, err := fint.Execute(&common.Opt{SrcRoot: SrcRootObjcSuppress, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, ReportUnusedSuppressions: true})
+	testExpectSuccess(t, err)
+	// Violations in SuppressFile.m should be suppressed by disable-file.
+	expected := []string{
+		"Suppress.m:3:WhitespaceAfterComma",
+		"Suppress.m:8:WhitespaceAfterComma",
+		"Suppress.m:8:UnusedSuppression",
+		"Suppress.m:9:WhitespaceAfterComma",
+		"Suppress.m:11:WhitespaceBeforeElse",
+	}
+	var actual []string
+	for i := range v {
+		actual = append(actual, fmt.Sprintf("%s:%d:%s", filepath.Base(v[i].Filename), v[i].Line, v[i].RuleId))
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected violations are %v but were %v", expected, actual)
+	}
+
+	// Suppressed violations should not be fixed, but the others in the same lines should be fixed.
+	dir := "testdata_suppress_fix"
+	os.RemoveAll(dir)
+	fint.CopyDir(SrcRootObjcSuppress, dir)
+	defer os.RemoveAll(dir)
+	_, err = fint.Execute(&common.Opt{SrcRoot: dir, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Fix: true})
+	testExpectSuccess(t, err)
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "Suppress.m"))
+	lines := strings.Split(string(b), "\n")
+	for n, line := range map[int]string{2: "int a,b;", 3: "int c, d;", 5: "int e,f;", 6: "}else {", 9: "int i, j;", 11: "} else {int k,l;}"} {
+		if lines[n-1] != line {
+			t.Errorf("Expected line %d is [%s] but was [%s]", n, line, lines[n-1])
+		}
+	}
+}
+
+func TestIgnore(t *testing.T) {
+	// Files ignored by .fintignore at any level should not be linted.
+	v, err := fint.Execute(&common.Opt{SrcRoot: SrcRootObjcIgnore, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc})
+	testExpectSuccess(t, err)
+	testExpectFiles(t, v, SrcRootObjcIgnore, []string{"Dir/Root.m", "Keep.generated.m", "Main.m", "Sub/Other.m"})
+
+	// Exclude patterns of rule sets and modules should be applied with .fintignore.
+	c := &common.Config{Targets: []common.Target{common.Target{Id: LintIdObjc, RuleSets: []common.RuleSet{
+		common.RuleSet{Id: "ObjectiveCSource", Exclude: []string{"Dir/"}, Modules: []common.Module{
+			common.Module{Id: "pattern_match", Pattern: ".*\\.m$", Exclude: []string{"Main.m"}, Rules: []common.Rule{
+				common.Rule{Id: "WhitespaceAfterComma", Args: []interface{}{"^(.*),([^ $])", ""}, Message: map[string]string{LocaleDefault: "Space must be inserted after ','"}}}}}}}}}}
+	l := fint.NewLinter(&common.Opt{Locale: LocaleDefault}, c)
+	testExpectSuccess(t, l.Lint(SrcRootObjcIgnore))
+	testExpectFiles(t, l.Violations(), SrcRootObjcIgnore, []string{"Keep.generated.m", "Sub/Other.m"})
+
+	// Modules of LintWalk should also skip ignored files.
+	fmap, err := modules.LintWalk(SrcRootObjcIgnore, c.Targets[0].RuleSets[0].Modules[0], LocaleDefault, false, modules.LintPatternMatchFunc)
+	testExpectSuccess(t, err)
+	var files []string
+	for f := range fmap {
+		files = append(files, filepath.ToSlash(strings.TrimPrefix(f, SrcRootObjcIgnore+string(filepath.Separator))))
+	}
+	sort.Strings(files)
+	if expected := []string{"Dir/Root.m", "Keep.generated.m", "Main.m", "Sub/Other.m"}; !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected files are %v but were %v", expected, files)
+	}
+	_, err = modules.LintWalk(filepath.Join(SrcRootObjcIgnore, "NonExistent.m"), c.Targets[0].RuleSets[0].Modules[0], LocaleDefault, false, modules.LintPatternMatchFunc)
+	testExpectError(t, err)
+
+	// Single files should be ignored and excluded in the same way.
+	wd, _ := os.Getwd()
+	for _, sc := range []struct {
+		file    string
+		linted  bool
+		exclude bool
+	}{
+		{"Pods/Lib.m", false, false},
+		{"Root.m", false, false},
+		{"A.generated.m", false, false},
+		{"Dir/Local.m", false, false},
+		{"Sub/a/b/Deep.m", false, false},
+		{"Dir/Root.m", true, false},
+		{"Keep.generated.m", true, false},
+		{"Dir/Root.m", false, true},
+		{"Main.m", false, true},
+		{"Sub/Other.m", true, true},
+	} {
+		for _, src := range []string{filepath.Join(SrcRootObjcIgnore, sc.file), filepath.Join(wd, SrcRootObjcIgnore, sc.file)} {
+			var v []common.Violation
+			if sc.exclude {
+				l := fint.NewLinter(&common.Opt{Locale: LocaleDefault}, c)
+				testExpectSuccess(t, l.Lint(src))
+				v = l.Violations()
+			} else {
+				v, err = fint.Execute(&common.Opt{SrcRoot: src, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc})
+				testExpectSuccess(t, err)
+			}
+			if linted := 0 < len(v); linted != sc.linted {
+				t.Errorf("Expected [%s] linted [%v] but was [%v]", src, sc.linted, linted)
+			}
+		}
+	}
+}
+
+func TestBaseline(t *testing.T) {
+	dir := "testdata_baseline"
+	file := dir + ".json"
+	os.RemoveAll(dir)
+	fint.CopyDir(SrcRootObjcColumns, dir)
+	defer os.RemoveAll(dir)
+	defer os.Remove(file)
+	opt := &common.Opt{SrcRoot: dir, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Baseline: file, Quiet: true}
+	testExpectSuccess(t, fint.BaselineAsCommand(opt))
+	b, err := fint.ReadBaseline(file)
+	testExpectSuccess(t, err)
+	if len(b.Violations) != 4 {
+		t.Errorf("Expected baseline entries are [%d] but [%d] found", 4, len(b.Violations))
+	}
+
+	if b.Violations[0].File != dir+"/Columns.m" {
+		t.Errorf("Expected baseline file is [%s] but was [%s]", dir+"/Columns.m", b.Violations[0].File)
+	}
+
+	// Known violations should not be reported.
+	testExpectSuccess(t, fint.ExecuteAsCommand(opt))
+
+	// Known violations should not be reported from the other directories.
+	wd, _ := os.Getwd()
+	other := &common.Opt{SrcRoot: filepath.Join(wd, dir), ConfigPath: filepath.Join(wd, ConfigDefault), Locale: LocaleDefault, Id: LintIdObjc, Baseline: filepath.Join(wd, file), Quiet: true}
+	testExpectSuccess(t, fint.ExecuteAsCommand(other))
+	os.Chdir(dir)
+	other.SrcRoot = "."
+	err = fint.ExecuteAsCommand(other)
+	os.Chdir(wd)
+	testExpectSuccess(t, err)
+
+	// Only new violations should be reported even if the known ones move.
+	// Known violations which no longer occur should be reported if required.
+	src := filepath.Join(dir, "Columns.m")
+	content, _ := ioutil.ReadFile(src)
+	content = []byte("int x,y;\n\n" + strings.Replace(string(content), "}else {\n", "", 1))
+	ioutil.WriteFile(src, content, 0666)
+	opt.ReportUnusedBaseline = true
+	v, err := fint.Execute(opt)
+	testExpectSuccess(t, err)
+	var actual []string
+	for i := range v {
+		actual = append(actual, fmt.Sprintf("%d:%s:%s", v[i].Line, v[i].RuleId, v[i].Message))
+	}
+	expected := []string{
+		"1:WhitespaceAfterComma:Space must be inserted after ','",
+		"0:UnusedBaselineEntry:Baseline entry of WhitespaceBeforeElse no longer occurs",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected violations are %v but were %v", expected, actual)
+	}
+	os.Setenv(EnvTerm, "dumb")
+	opt.Quiet = false
+	testExpectError(t, fint.ExecuteAsCommand(opt))
+
+	// Identical violations over the counts should be reported from the last lines in every run.
+	ioutil.WriteFile(src, []byte("int a,b;\nint a,b;\n"), 0666)
+	opt.ReportUnusedBaseline = false
+	testExpectSuccess(t, fint.BaselineAsCommand(opt))
+	ioutil.WriteFile(src, []byte("int a,b;\nint a,b;\nint a,b;\nint a,b;\n"), 0666)
+	for i := 0; i < 10; i++ {
+		v, err = fint.Execute(opt)
+		testExpectSuccess(t, err)
+		if len(v) != 2 || v[0].Line != 3 || v[1].Line != 4 {
+			t.Fatalf("Expected violations in lines 3 and 4 but were %v", v)
+		}
+	}
+
+	// Invalid baseline files should be errors.
+	opt.Baseline = ConfigDefault + "/builtin/modules/max_length/config.json"
+	testExpectErrorWithMessage(t, fint.ExecuteAsCommand(opt), "fint: unsupported baseline file ["+opt.Baseline+"]")
+}
+
+func TestDiff(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "fint_diff")
+	defer os.RemoveAll(dir)
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=fint", "-c", "user.email=fint@example.com"}, args...)...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, out)
+		}
+	}
+	git("init", "-q")
+	ioutil.WriteFile(filepath.Join(dir, "A.m"), []byte("int a,b;\nint c,d;\n"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "B.m"), []byte("int a,b;\n"), 0666)
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	baseline := filepath.Join(dir, "baseline.json")
+	testExpectSuccess(t, fint.BaselineAsCommand(&common.Opt{SrcRoot: dir, ConfigPath: ConfigDefault, Id: LintIdObjc, Baseline: baseline, Quiet: true}))
+
+	// Violations only in the changed lines of the changed files should be reported.
+	ioutil.WriteFile(filepath.Join(dir, "A.m"), []byte("int a,b;\nint c,d;\nint e,f;\n"), 0666)
+	opt := &common.Opt{SrcRoot: dir, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, DiffBase: "HEAD"}
+	v, err := fint.Execute(opt)
+	testExpectSuccess(t, err)
+	if len(v) != 1 || filepath.Base(v[0].Filename) != "A.m" || v[0].Line != 3 {
+		t.Errorf("Expected a violation in A.m:3 but were %v", v)
+	}
+
+	// Baseline entries should be counted in the unchanged lines,
+	// and the entries of the files not linted should not be reported as unused.
+	opt.Baseline, opt.ReportUnusedBaseline = baseline, true
+	v, err = fint.Execute(opt)
+	testExpectSuccess(t, err)
+	if len(v) != 1 || v[0].Line != 3 {
+		t.Errorf("Expected a violation in A.m:3 with the baseline but were %v", v)
+	}
+	opt.Baseline, opt.ReportUnusedBaseline = "", false
+
+	// Prefixes of the paths in git config should not hide the changes.
+	for _, config := range []string{"diff.noprefix", "diff.mnemonicPrefix"} {
+		git("config", config, "true")
+		v, err = fint.Execute(opt)
+		testExpectSuccess(t, err)
+		if len(v) != 1 || v[0].Line != 3 {
+			t.Errorf("Expected a violation in A.m:3 with %s but were %v", config, v)
+		}
+		git("config", "--unset", config)
+	}
+
+	// Only staged lines should be reported with Staged.
+	opt.DiffBase = ""
+	opt.Staged = true
+	v, err = fint.Execute(opt)
+	testExpectSuccess(t, err)
+	if len(v) != 0 {
+		t.Errorf("Expected no violations but were %v", v)
+	}
+	git("add", "A.m")
+	v, err = fint.Execute(opt)
+	testExpectSuccess(t, err)
+	if len(v) != 1 || v[0].Line != 3 {
+		t.Errorf("Expected a violation in A.m:3 but were %v", v)
+	}
+
+	// Staged content should be linted regardless of the unstaged lines.
+	ioutil.WriteFile(filepath.Join(dir, "A.m"), []byte("// x\nint a,b;\nint c, d;\nint e,f;\n"), 0666)
+	v, err = fint.Execute(opt)
+	testExpectSuccess(t, err)
+	if len(v) != 1 || v[0].Line != 3 {
+		t.Errorf("Expected a violation in staged A.m:3 but were %v", v)
+	}
+	opt.Fix = true
+	testExecuteError(t, opt, "fint: fix and HTML report are not supported for staged changes.")
+	opt.Fix = false
+
+	// Paths with spaces and special characters should be matched,
+	// and all the lines of the untracked files except for the ignored ones are changed.
+	names := []string{"foo bar.m"}
+	if runtime.GOOS != "windows" {
+		names = append(names, "quo\"te.m")
+	}
+	for _, name := range names {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte("int a;\n"), 0666)
+	}
+	git("add", ".")
+	git("commit", "-q", "-m", "names")
+	for _, name := range names {
+		ioutil.WriteFile(filepath.Join(dir, name), []byte("int a;\nint b,c;\n"), 0666)
+	}
+	ioutil.WriteFile(filepath.Join(dir, "New.m"), []byte("int a;\nint b,c;\n"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "Ignored.m"), []byte("int a;\nint b,c;\n"), 0666)
+	ioutil.WriteFile(filepath.Join(dir, ".gitignore"), []byte("Ignored.m\n"), 0666)
+	names = append(names, "New.m")
+	v, err = fint.Execute(&common.Opt{SrcRoot: dir, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, DiffBase: "HEAD"})
+	testExpectSuccess(t, err)
+	var actual []string
+	for i := range v {
+		actual = append(actual, fmt.Sprintf("%s:%d", filepath.Base(v[i].Filename), v[i].Line))
+	}
+	var expected []string
+	for _, name := range names {
+		expected = append(expected, name+":2")
+	}
+	sort.Strings(actual)
+	sort.Strings(expected)
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected violations are %v but were %v", expected, actual)
+	}
+
+	// Unknown revisions should be errors.
+	opt.Staged = false
+	opt.DiffBase = "non_existent_revision"
+	if _, err = fint.Execute(opt); err == nil || !strings.HasPrefix(err.Error(), "fint: git diff failed: ") {
+		t.Errorf("Expected git error but was [%v]", err)
+	}
+}
+
+func TestLintReader(t *testing.T) {
+	l := fint.NewLinter(&common.Opt{ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Fix: true}, nil)
+	testExpectSuccess(t, l.LoadConfig())
+
+	// Modules should be selected by the virtual file name,
+	// and only the violations which are not fixed should be reported.
+	long := "// " + strings.Repeat("x", 80)
+	lines, err := l.LintReader(strings.NewReader("int a,b;\n}else {\n"+long+"\n"), "Virtual.m")
+	testExpectSuccess(t, err)
+	if v := l.Violations(); len(v) != 1 || v[0].Line != 3 || v[0].Fixed {
+		t.Errorf("Expected a violation in line 3 but were %v", v)
+	}
+	if expected := []string{"int a, b;", "} else {", long, ""}; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected fixed lines are %v but were %v", expected, lines)
+	}
+	lines, err = l.LintReader(strings.NewReader("int a,b;\n"), "Virtual.txt")
+	testExpectSuccess(t, err)
+	if len(l.Violations()) != 0 {
+		t.Errorf("Expected no violations but found %v", l.Violations())
+	}
+
+	// Stdin should be linted as the file name.
+	stdin := os.Stdin
+	defer func() { os.Stdin = stdin }()
+	os.Stdin, _ = os.Open(filepath.Join(SrcRootObjcColumns, "Columns.m"))
+	defer os.Stdin.Close()
+	os.Setenv(EnvTerm, "dumb")
+	testExpectError(t, fint.ExecuteAsCommand(&common.Opt{ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Stdin: true, StdinFilename: "Columns.m"}))
+	testExecuteError(t, &common.Opt{ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Stdin: true}, "fint: file name of stdin is required.")
+	testExecuteError(t, &common.Opt{ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Stdin: true, StdinFilename: "Columns.m", Html: TestReportDir},
+		"fint: HTML report is not supported for stdin.")
+}
+
+func TestDryRun(t *testing.T) {
+	dir := "testdata_dry_run"
+	os.RemoveAll(dir)
+	os.Mkdir(dir, 0777)
+	defer os.RemoveAll(dir)
+	src := "int a,b;\nint c;\nint d;\nint e;\nint f;\nint g;\nint h;\nint i;\nint j,k;"
+	ioutil.WriteFile(filepath.Join(dir, "A.m"), []byte(src), 0666)
+	ioutil.WriteFile(filepath.Join(dir, "B.m"), []byte("int x;\n"), 0666)
+
+	// Fixes should be a unified diff and files should not be changed.
+	l := fint.NewLinter(&common.Opt{ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Fix: true, DryRun: true}, nil)
+	testExpectSuccess(t, l.LoadConfig())
+	testExpectSuccess(t, l.Lint(dir))
+	expected := `--- a/testdata_dry_run/A.m
++++ b/testdata_dry_run/A.m
+@@ -1,4 +1,4 @@
+-int a,b;
++int a, b;
+ int c;
+ int d;
+ int e;
+@@ -6,4 +6,4 @@
+ int g;
+ int h;
+ int i;
+-int j,k;
+\ No newline at end of file
++int j, k;
+\ No newline at end of file
+`
+	if actual := l.Patch(); actual != expected {
+		t.Errorf("Expected patch is [%s] but was [%s]", expected, actual)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(dir, "A.m")); string(b) != src {
+		t.Errorf("Expected file is not changed but was [%s]", b)
+	}
+
+	// Stdin should be compared with its fixed content.
+	_, err := l.LintReader(strings.NewReader("int a,b;\n"), "Virtual.m")
+	testExpectSuccess(t, err)
+	if expected := "--- a/Virtual.m\n+++ b/Virtual.m\n@@ -1 +1 @@\n-int a,b;\n+int a, b;\n"; l.Patch() != expected {
+		t.Errorf("Expected patch is [%s] but was [%s]", expected, l.Patch())
+	}
+
+	testExecuteError(t, &common.Opt{SrcRoot: dir, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, DryRun: true},
+		"fint: dry run is only available with fix.")
+	testExecuteError(t, &common.Opt{SrcRoot: dir, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Fix: true, DryRun: true, Html: TestReportDir},
+		"fint: HTML report is not supported for dry run.")
+}
+
+func TestFixRounds(t *testing.T) {
+	l := fint.NewLinter(&common.Opt{ConfigPath: ConfigFix, Locale: LocaleDefault, Id: "fix", Fix: true}, nil)
+	testExpectSuccess(t, l.LoadConfig())
+
+	// Conflicting fixes and the violations caused by fixes should be fixed in the following rounds,
+	// and fixes which never become stable should stop at the limit.
+	lines, err := l.LintReader(strings.NewReader("a,b\tc\n<>\nping\n"), "Fix.txt")
+	testExpectSuccess(t, err)
+	if expected := []string{"a, b c", "a, b", "ping", ""}; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("Expected fixed lines are %v but were %v", expected, lines)
+	}
+	if v := l.Violations(); len(v) != 1 || v[0].RuleId != "Ping" || v[0].Line != 3 || v[0].Fixed {
+		t.Errorf("Expected a violation of Ping in line 3 but were %v", v)
+	}
+}
+
+func TestWriteLines(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "fint_write")
+	defer os.RemoveAll(dir)
+	filename := filepath.Join(dir, "A.m")
+	ioutil.WriteFile(filename, []byte("int a,b;\n"), 0666)
+	os.Chmod(filename, 0750)
+
+	// Fixed files should keep their modes without temporary files left.
+	_, err := fint.Execute(&common.Opt{SrcRoot: dir, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Fix: true})
+	testExpectSuccess(t, err)
+	if b, _ := ioutil.ReadFile(filename); string(b) != "int a, b;\n" {
+		t.Errorf("Expected fixed content but was [%s]", b)
+	}
+	fi, _ := os.Stat(filename)
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0750 {
+		t.Errorf("Expected mode is [%v] but was [%v]", os.FileMode(0750), fi.Mode().Perm())
+	}
+	if entries, _ := ioutil.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the fixed file but found %d files", len(entries))
+	}
+
+	// Unchanged content should not be written.
+	past := fi.ModTime().Add(-time.Hour)
+	os.Chtimes(filename, past, past)
+	testExpectSuccess(t, modules.WriteLines(filename, []string{"int a, b;", ""}))
+	if fi, _ = os.Stat(filename); !fi.ModTime().Equal(past) {
+		t.Errorf("Expected the file is not written but was modified at %v", fi.ModTime())
+	}
+
+	// Hard links and symbolic links should be kept.
+	link, symlink := filepath.Join(dir, "B.m"), filepath.Join(dir, "C.m")
+	if err := os.Link(filename, link); err != nil {
+		t.Skipf("hard links are not available: %v", err)
+	}
+	if err := os.Symlink("A.m", symlink); err != nil {
+		t.Skipf("symbolic links are not available: %v", err)
+	}
+	testExpectSuccess(t, modules.WriteLines(symlink, []string{"int c;", ""}))
+	if b, _ := ioutil.ReadFile(link); string(b) != "int c;\n" {
+		t.Errorf("Expected the content of the hard link is changed but was [%s]", b)
+	}
+	if fi, _ = os.Lstat(symlink); fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Expected the symbolic link is kept but was [%v]", fi.Mode())
+	}
+	os.Remove(link)
+	testExpectSuccess(t, modules.WriteLines(symlink, []string{"int d;", ""}))
+	if b, _ := ioutil.ReadFile(filename); string(b) != "int d;\n" {
+		t.Errorf("Expected the content of the link target is changed but was [%s]", b)
+	}
+}
+
+func TestMultipleTargets(t *testing.T) {
+	// Violations of all the targets should be merged in a walk.
+	expected := []string{
+		"Dockerfile:2:InstructionsOrComment:dockerfile",
+		"Foo.m:1:WhitespaceAfterComma:objc",
+		"build.sh:1:InvalidRedirect:sh",
+	}
+	for _, id := range []string{"objc,sh,dockerfile", "all", "sh, dockerfile,objc,sh"} {
+		v, err := fint.Execute(&common.Opt{SrcRoot: SrcRootMixed, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: id})
+		testExpectSuccess(t, err)
+		var actual []string
+		for i := range v {
+			actual = append(actual, fmt.Sprintf("%s:%d:%s:%s", filepath.Base(v[i].Filename), v[i].Line, v[i].RuleId, v[i].TargetId))
+		}
+		if !reflect.DeepEqual(actual, expected) {
+			t.Errorf("Expected violations for [%s] are %v but were %v", id, expected, actual)
+		}
+	}
+
+	// All the targets should exist.
+	testExecuteError(t, &common.Opt{SrcRoot: SrcRootMixed, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: "objc,non_existent"}, "fint: no matching target to [non_existent]")
+	testExecuteError(t, &common.Opt{SrcRoot: SrcRootMixed, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: ","}, "fint: no matching target to [,]")
+
+	// A report should include all the targets.
+	testExecuteNormalWithReport(t, &common.Opt{SrcRoot: SrcRootMixed, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: "all", Html: TestReportDir, Template: TemplateDefault, Force: true}, 3, true, true)
+}
+
+func TestExtends(t *testing.T) {
+	// The extended target should not be changed by the extending target.
+	v, err := fint.Execute(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigExtends, Locale: LocaleDefault, Id: LintIdObjc})
+	testExpectSuccess(t, err)
+	if len(v) != 4 {
+		t.Errorf("Expected violations are [%d] but [%d] found: %v", 4, len(v), v)
+	}
+
+	// Rules should be overridden, removed and added.
+	v, err = fint.Execute(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigExtends, Locale: LocaleDefault, Id: "objc_custom"})
+	testExpectSuccess(t, err)
+	expected := []string{
+		"1:WhitespaceAfterComma:warning:Space must be inserted after ','",
+		"2:Whitespaces:error:Tabs are not allowed",
+		"3:LineComment:warning:Use block comments",
+	}
+	var actual []string
+	for i := range v {
+		actual = append(actual, fmt.Sprintf("%d:%s:%s:%s", v[i].Line, v[i].RuleId, v[i].Severity, v[i].Message))
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected violations are %v but were %v", expected, actual)
+	}
+
+	// Cyclic and missing targets should be problems.
+	problems, err := fint.Validate(&common.Opt{ConfigPath: ConfigExtends, Id: "cycle_a,missing"})
+	testExpectSuccess(t, err)
+	expectedProblems := []string{
+		ConfigExtends + "/builtin/targets/cycle_b/ruleset.json: extends: cyclic extends [cycle_a -> cycle_b -> cycle_a]",
+		ConfigExtends + "/builtin/targets/missing/ruleset.json: extends: no matching target to [none]",
+	}
+	actual = nil
+	for i := range problems {
+		actual = append(actual, problems[i].String())
+	}
+	if !reflect.DeepEqual(actual, expectedProblems) {
+		t.Errorf("Expected problems are %v but were %v", expectedProblems, actual)
+	}
+}
+
+func TestConfigLayers(t *testing.T) {
+	userConfig := os.Getenv(EnvXdgConfigHome)
+	os.Setenv(EnvXdgConfigHome, ConfigLayersUser)
+	defer os.Setenv(EnvXdgConfigHome, userConfig)
+
+	// Targets in the former layers should hide the others.
+	expected := []fint.TargetInfo{
+		fint.TargetInfo{Id: "dockerfile", Layer: fint.LayerEmbedded, Path: fint.PathEmbedded + "/targets/dockerfile"},
+		fint.TargetInfo{Id: LintIdObjc, Layer: fint.LayerBuiltin, Path: filepath.Join(ConfigLayers, "builtin", "targets", LintIdObjc)},
+		fint.TargetInfo{Id: "objc_user", Layer: fint.LayerUser, Path: filepath.Join(ConfigLayersUser, "fint", "targets", "objc_user")},
+		fint.TargetInfo{Id: "sh", Layer: fint.LayerEmbedded, Path: fint.PathEmbedded + "/targets/sh"},
+		fint.TargetInfo{Id: "strict", Layer: fint.LayerCustom, Path: filepath.Join(ConfigLayers, "custom", "targets", "strict")},
+	}
+	if actual := fint.ListTargets(fint.ConfigLayers(&common.Opt{ConfigPath: ConfigLayers})); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected targets are %v but were %v", expected, actual)
+	}
+	testExpectSuccess(t, fint.ListTargetsAsCommand(&common.Opt{ConfigPath: ConfigLayers}))
+
+	// Custom targets should extend the targets in the other layers.
+	v, err := fint.Execute(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigLayers, Locale: LocaleDefault, Id: "strict"})
+	testExpectSuccess(t, err)
+	if len(v) != 4 || v[2].RuleId != "ExceedMaxLength" || v[2].Severity != common.SeverityError {
+		t.Errorf("Expected ExceedMaxLength to be an error but violations were %v", v)
+	}
+	v, err = fint.Execute(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigLayers, Locale: LocaleDefault, Id: "all"})
+	testExpectSuccess(t, err)
+	if len(v) != 9 {
+		t.Errorf("Expected violations are [%d] but [%d] found: %v", 9, len(v), v)
+	}
+	problems, err := fint.Validate(&common.Opt{ConfigPath: ConfigLayers})
+	testExpectSuccess(t, err)
+	if len(problems) != 0 {
+		t.Errorf("Expected no problems but found %v", problems)
+	}
+}
+
+func TestEmbeddedConfig(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "fint_embedded")
+	defer os.RemoveAll(dir)
+
+	// The embedded config should be used without config files.
+	testExecuteNormal(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: dir, Locale: LocaleDefault, Id: LintIdObjc}, ErrorsObjcNormal)
+	testExecuteNormal(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigNoTarget, Locale: LocaleDefault, Id: LintIdObjc}, ErrorsObjcNormal)
+	testExecuteNormalWithReport(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: dir, Locale: LocaleDefault, Id: LintIdObjc, Html: TestReportDir, Template: TemplateDefault, Force: true}, ErrorsObjcNormal, true, true)
+	problems, err := fint.Validate(&common.Opt{ConfigPath: dir})
+	testExpectSuccess(t, err)
+	if len(problems) != 0 {
+		t.Errorf("Expected no problems but found %v", problems)
+	}
+	for _, target := range fint.ListTargets(fint.ConfigLayers(&common.Opt{ConfigPath: dir})) {
+		if target.Layer != fint.LayerEmbedded {
+			t.Errorf("Expected target [%s] to be embedded but was in [%s]", target.Id, target.Layer)
+		}
+	}
+
+	// Init should write the embedded config to the config directory.
+	o := &common.Opt{ConfigPath: dir, Quiet: true}
+	testExpectSuccess(t, fint.InitAsCommand(o))
+	for _, name := range []string{"targets/objc/ruleset.json", "templates/default/_index.html"} {
+		expected, _ := ioutil.ReadFile(filepath.Join(ConfigDefault, "builtin", filepath.FromSlash(name)))
+		actual, err := ioutil.ReadFile(filepath.Join(dir, "builtin", filepath.FromSlash(name)))
+		testExpectSuccess(t, err)
+		if string(actual) != string(expected) {
+			t.Errorf("Expected [%s] to be written from the embedded config", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "custom", "targets")); err != nil {
+		t.Errorf("Expected custom targets directory to be created: %v", err)
+	}
+	testExpectErrorWithMessage(t, fint.InitAsCommand(o),
+		"fint: config directory ["+filepath.Join(dir, "builtin")+"] already exists. use `-f` option to overwrite.")
+	o.Force = true
+	testExpectSuccess(t, fint.InitAsCommand(o))
+	testExecuteNormal(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: dir, Locale: LocaleDefault, Id: LintIdObjc}, ErrorsObjcNormal)
+}
+
+func TestConfigDir(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "fint_config_dir")
+	defer os.RemoveAll(dir)
+	repo := filepath.Join(dir, "repo")
+	src := filepath.Join(repo, "src", "sub")
+	os.MkdirAll(filepath.Join(repo, ".git"), 0777)
+	os.MkdirAll(src, 0777)
+	ioutil.WriteFile(filepath.Join(src, "a.m"), []byte("int a,b;\n"), 0666)
+
+	// Search should stop at the repository root and fall back to the current directory.
+	os.MkdirAll(filepath.Join(dir, ".fint"), 0777)
+	cwdConfig, _ := filepath.Abs(ConfigDefault)
+	if actual := fint.ConfigDir(&common.Opt{SrcRoot: src}); actual != cwdConfig {
+		t.Errorf("Expected config directory is [%s] but was [%s]", cwdConfig, actual)
+	}
+
+	// The nearest config directory from the source root should be used.
+	target := filepath.Join(repo, ".fint", "custom", "targets", "local")
+	os.MkdirAll(target, 0777)
+	ioutil.WriteFile(filepath.Join(target, "ruleset.json"), []byte(`{"extends": "objc", "rulesets": []}`), 0666)
+	for _, o := range []*common.Opt{
+		&common.Opt{SrcRoot: src},
+		&common.Opt{SrcRoot: filepath.Join(src, "a.m")},
+		&common.Opt{Stdin: true, StdinFilename: filepath.Join(src, "b.m")},
+	} {
+		if actual := fint.ConfigDir(o); actual != filepath.Join(repo, ".fint") {
+			t.Errorf("Expected config directory is [%s] but was [%s]", filepath.Join(repo, ".fint"), actual)
+		}
+	}
+	if actual := fint.ConfigDir(&common.Opt{SrcRoot: src, ConfigPath: ConfigDefault}); actual != ConfigDefault {
+		t.Errorf("Expected config directory is [%s] but was [%s]", ConfigDefault, actual)
+	}
+	testExecuteNormal(t, &common.Opt{SrcRoot: src, Locale: LocaleDefault, Id: "local"}, 1)
+	os.Setenv(EnvTerm, "dumb")
+	testExpectError(t, fint.ExecuteAsCommand(&common.Opt{SrcRoot: src, Locale: LocaleDefault, Id: "local", FailOn: common.SeverityWarning, Verbose: true}))
+	testExpectSuccess(t, fint.ValidateAsCommand(&common.Opt{SrcRoot: src, Verbose: true}))
+}
+
+func TestLocales(t *testing.T) {
+	// Messages should be matched by IDs and fall back to en and then to the rule ID.
+	for _, c := range []struct {
+		locale   string
+		expected []string
+	}{
+		{LocaleJa, []string{
+			"Space must be inserted after ','",
+			"インデントにはタブではなくスペースを使用してください",
+			"Line length exceeds 80 characters",
+			"elseの前にはスペースを入れてください",
+		}},
+		{LocaleDefault, []string{
+			"Space must be inserted after ','",
+			"Whitespaces",
+			"Line length exceeds 80 characters",
+			"Space must be inserted before else",
+		}},
+	} {
+		v, err := fint.Execute(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigLocales, Locale: c.locale, Id: LintIdObjc})
+		testExpectSuccess(t, err)
+		var actual []string
+		for i := range v {
+			actual = append(actual, v[i].Message)
+		}
+		if !reflect.DeepEqual(actual, c.expected) {
+			t.Errorf("Expected messages for [%s] are %v but were %v", c.locale, c.expected, actual)
+		}
+	}
+
+	// Missing and orphaned messages should be reported.
+	issues, err := fint.CheckLocales(&common.Opt{ConfigPath: ConfigLocales, Id: LintIdObjc})
+	testExpectSuccess(t, err)
+	expected := []string{
+		"target [objc]: locale [ja]: missing message for rule [WhitespaceAfterComma] of module [pattern_match] in rule set [ObjectiveCSource]",
+		"target [objc]: locale [en]: missing message for rule [Whitespaces] of module [indent] in rule set [ObjectiveCSource]",
+		"target [objc]: locale [ja]: missing message for rule [ExceedMaxLength] of module [max_length] in rule set [ObjectiveCSource]",
+		filepath.Join(ConfigLocales, "builtin", "targets", "objc", "locales", "ja.json") + ": orphaned message for rule [Unknown] of module [pattern_match] in rule set [ObjectiveCSource]",
+	}
+	var actual []string
+	for i := range issues {
+		actual = append(actual, issues[i].String())
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected issues are %v but were %v", expected, actual)
+	}
+	testExpectError(t, fint.CheckLocalesAsCommand(&common.Opt{ConfigPath: ConfigLocales, Quiet: true}))
+	testExpectSuccess(t, fint.CheckLocalesAsCommand(&common.Opt{ConfigPath: ConfigDefault, Quiet: true}))
+}
+
+func TestDetectLocale(t *testing.T) {
+	names := []string{"LC_ALL", "LC_MESSAGES", "LANG"}
+	saved := make(map[string]string)
+	for _, name := range names {
+		saved[name] = os.Getenv(name)
+	}
+	defer func() {
+		for _, name := range names {
+			os.Setenv(name, saved[name])
+		}
+	}()
+
+	// Variables should be used in order of precedence and normalised.
+	for _, c := range []struct {
+		all, messages, lang string
+		expected            string
+	}{
+		{"", "", "", "en"},
+		{"", "", "ja_JP.UTF-8", "ja"},
+		{"", "ja_JP@calendar=japanese", "en_US.UTF-8", "ja"},
+		{"C", "ja_JP.UTF-8", "ja_JP.UTF-8", "en"},
+		{"fr-FR", "", "", "fr"},
+	} {
+		os.Setenv("LC_ALL", c.all)
+		os.Setenv("LC_MESSAGES", c.messages)
+		os.Setenv("LANG", c.lang)
+		if actual := fint.DetectLocale(); actual != c.expected {
+			t.Errorf("Expected locale for %v is [%s] but was [%s]", c, c.expected, actual)
+		}
+	}
+
+	// Detected locale should be used without -l, and en without its locale file.
+	os.Setenv("LC_ALL", "")
+	os.Setenv("LC_MESSAGES", "")
+	for _, c := range []struct {
+		lang, expected string
+	}{
+		{"ja_JP.UTF-8", "1行の長さ85文字が80文字を超えています"},
+		{"fr_FR.UTF-8", "Line length 85 exceeds 80 characters"},
+	} {
+		os.Setenv("LANG", c.lang)
+		v, err := fint.Execute(&common.Opt{SrcRoot: SrcRootObjcColumns, ConfigPath: ConfigDefault, Id: LintIdObjc})
+		testExpectSuccess(t, err)
+		if len(v) != 4 || v[2].Message != c.expected {
+			t.Errorf("Expected message for [%s] is [%s] but violations were %v", c.lang, c.expected, v)
+		}
+	}
+}
+
+func TestMessagePlaceholders(t *testing.T) {
+	// Named placeholders should be replaced and the unknown ones should be kept.
+	if actual := modules.FormatMessage("{a} is 100% {b}: {unknown}", map[string]string{"a": "foo", "b": "bar"}); actual != "foo is 100% bar: {unknown}" {
+		t.Errorf("Unexpected message: %s", actual)
+	}
+
+	// Each module should provide its placeholders with {rule} and {file}.
+	for _, c := range []struct {
+		f        modules.LintWalkFunc
+		rule     common.Rule
+		line     string
+		expected string
+	}{
+		{modules.LintPatternMatchFunc,
+			common.Rule{Id: "NoTodo", Args: []interface{}{"TODO\\S*", ""}, Message: map[string]string{"en": "{rule}: {match} in {file}"}},
+			"// TODO:fix", "NoTodo: TODO:fix in Foo.m"},
+		{modules.LintMaxLengthFunc,
+			common.Rule{Id: "ExceedMaxLength", Args: []interface{}{".*", 4.0}, Message: map[string]string{"en": "{actual} > {max}"}},
+			"abcdef", "6 > 4"},
+		{modules.LintMaxLengthFunc,
+			common.Rule{Id: "ExceedMaxLength", Args: []interface{}{".*", 4.0}, Message: map[string]string{"en": "Line length exceeds %d characters"}},
+			"abcdef", "Line length exceeds 4 characters"},
+	} {
+		m := common.Module{Rules: []common.Rule{c.rule}}
+		v, _, _ := c.f(m, 1, "Foo.m", c.line, LocaleDefault, false)
+		if len(v) != 1 || v[0].Message != c.expected {
+			t.Errorf("Expected message is [%s] but violations were %v", c.expected, v)
+		}
+	}
+}
+
+func testExpectFiles(t *testing.T, v []common.Violation, srcRoot string, expected []string) {
+	var files []string
+	for i := range v {
+		files = append(files, filepath.ToSlash(strings.TrimPrefix(v[i].Filename, srcRoot+string(filepath.Separator))))
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Errorf("Expected files are %v but were %v", expected, files)
+	}
 }
 
 func TestSetbufsizeAndLint(t *testing.T) {
@@ -101,6 +1276,15 @@ func TestSetbufsizeAndLint(t *testing.T) {
 
 	// Do normal test to initialize opt
 	testExecuteNormal(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigDefault, Locale: LocaleJa, Id: LintIdObjc}, ErrorsObjcNormal)
+	common.BufSize = 0
+
+	// Buffer size of each Linter should not change the results.
+	for _, size := range []int{1, 16, common.DefaultBufSize} {
+		testExecuteNormalWithReport(t, &common.Opt{SrcRoot: SrcRootObjcNormal, ConfigPath: ConfigDefault, Locale: LocaleDefault, Id: LintIdObjc, Html: TestReportDir, Template: TemplateDefault, Force: true, BufSize: size}, ErrorsObjcNormal, true, true)
+	}
+	if size := modules.BufSize(0); size != common.DefaultBufSize {
+		t.Errorf("Expected default buffer size is [%d] but was [%d]", common.DefaultBufSize, size)
+	}
 }
 
 func TestCopyDir(t *testing.T) {
@@ -170,6 +1354,28 @@ func testExecuteError(t *testing.T, opt *common.Opt, msg string) {
 	testExpectErrorWithMessage(t, err, msg)
 }
 
+func testCaptureStdout(t *testing.T, f func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create a pipe: %v", err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	done := make(chan []byte)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		done <- b
+	}()
+	defer func() {
+		os.Stdout = stdout
+	}()
+	f()
+	w.Close()
+	out := <-done
+	r.Close()
+	return string(out)
+}
+
 func testExpectSuccess(t *testing.T, err error) {
 	if err != nil {
 		t.Errorf("Expected success but an error occurred")
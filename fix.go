@@ -0,0 +1,177 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package fint
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxFixRounds is the maximum number of the rounds to apply the fixes to a file.
+// Fixes conflicting with the ones of the preceding checks and the fixes of the
+// violations caused by other fixes are applied in the following rounds.
+const maxFixRounds = 10
+
+// edit replaces the lines [start, end) with lines.
+// An edit whose start and end are the same inserts the lines.
+type edit struct {
+	start, end int
+	lines      []string
+}
+
+// conflicts returns whether e and o change the same lines,
+// or insert lines at the same position.
+func (e edit) conflicts(o edit) bool {
+	return e.start < o.end && o.start < e.end || e.start == o.start
+}
+
+// lineEdits returns the edits which change the lines before to after.
+func lineEdits(before, after []string) (edits []edit) {
+	ops := editScript(before, after)
+	n := 0
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			n++
+			i++
+			continue
+		}
+		e := edit{start: n, end: n}
+		for ; i < len(ops) && ops[i].kind != ' '; i++ {
+			if ops[i].kind == '-' {
+				e.end++
+				n++
+			} else {
+				e.lines = append(e.lines, ops[i].line)
+			}
+		}
+		edits = append(edits, e)
+	}
+	return
+}
+
+// mergeEdits returns the edits a and the edits b which conflict with none of a
+// sorted by their positions. Edits in a and b must be sorted and must not conflict
+// with the others in the same slice.
+func mergeEdits(a, b []edit) (merged []edit) {
+	i := 0
+	for _, e := range b {
+		for i < len(a) && a[i].end <= e.start && a[i].start < e.start {
+			merged = append(merged, a[i])
+			i++
+		}
+		// Edits after a[i] start after e ends
+		if i < len(a) && a[i].conflicts(e) {
+			continue
+		}
+		merged = append(merged, e)
+	}
+	return append(merged, a[i:]...)
+}
+
+// applyEdits returns the lines changed by the sorted edits.
+func applyEdits(lines []string, edits []edit) (applied []string) {
+	n := 0
+	for _, e := range edits {
+		applied = append(applied, lines[n:e.start]...)
+		applied = append(applied, e.lines...)
+		n = e.end
+	}
+	return append(applied, lines[n:]...)
+}
+
+// dropSuppressedFixes returns the lines fixed by the check c without the fixes of the
+// suppressed violations, whose rule IDs are in suppressed for each line.
+// The lines of the suppressed violations are fixed again without their rules,
+// so that the other violations in the lines are still fixed.
+func dropSuppressedFixes(c check, filename string, lines, fixed []string, suppressed map[int][]string) ([]string, error) {
+	// Lines for each set of the suppressed rules
+	groups := make(map[string][]int)
+	var keys []string
+	for n, ids := range suppressed {
+		sort.Strings(ids)
+		key := strings.Join(ids, " ")
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], n)
+	}
+	sort.Strings(keys)
+
+	if len(fixed) == len(lines) {
+		kept := append([]string(nil), fixed...)
+		for _, key := range keys {
+			refixed, err := fixWithout(c, filename, lines, strings.Fields(key))
+			if err != nil {
+				return nil, err
+			}
+			for _, n := range groups[key] {
+				if n < 1 || len(lines) < n {
+					continue
+				}
+				kept[n-1] = lines[n-1]
+				if len(refixed) == len(lines) {
+					kept[n-1] = refixed[n-1]
+				}
+			}
+		}
+		return kept, nil
+	}
+
+	// Fixes changing the number of lines are replaced by the edits
+	// which change the lines or insert lines before them
+	touches := func(e edit, ns []int) bool {
+		for _, n := range ns {
+			if e.start <= n-1 && n-1 < e.end || e.start == n-1 {
+				return true
+			}
+		}
+		return false
+	}
+	var all []int
+	for _, key := range keys {
+		all = append(all, groups[key]...)
+	}
+	var edits []edit
+	for _, e := range lineEdits(lines, fixed) {
+		if !touches(e, all) {
+			edits = append(edits, e)
+		}
+	}
+	for _, key := range keys {
+		refixed, err := fixWithout(c, filename, lines, strings.Fields(key))
+		if err != nil {
+			return nil, err
+		}
+		var replaced []edit
+		for _, e := range lineEdits(lines, refixed) {
+			if touches(e, groups[key]) {
+				replaced = append(replaced, e)
+			}
+		}
+		edits = mergeEdits(edits, replaced)
+	}
+	return applyEdits(lines, edits), nil
+}
+
+// fixWithout returns the lines fixed by the check c without the rules excluded.
+func fixWithout(c check, filename string, lines []string, excluded []string) ([]string, error) {
+	m := c.m
+	m.Rules = nil
+	for _, r := range c.m.Rules {
+		if !contains(excluded, r.Id) {
+			m.Rules = append(m.Rules, r)
+		}
+	}
+	if len(m.Rules) == 0 {
+		return lines, nil
+	}
+	_, fixed, err := c.mod.Lint(m, filename, lines, c.locale, true)
+	if err != nil {
+		return nil, err
+	}
+	if fixed == nil {
+		return lines, nil
+	}
+	return fixed, nil
+}
@@ -0,0 +1,305 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package fint
+
+import (
+	"embed"
+	"fmt"
+	"github.com/ksoichiro/fint/common"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+const (
+	LayerCustom   = "custom"
+	LayerUser     = "user"
+	LayerBuiltin  = "builtin"
+	LayerEmbedded = "embedded"
+
+	// PathEmbedded is shown as the directory of the embedded layer.
+	PathEmbedded = "(embedded)"
+)
+
+// embedded is the builtin config bundled in the executable.
+//
+//go:embed all:.fint/builtin
+var embedded embed.FS
+
+// EmbeddedConfig returns the builtin config bundled in the executable,
+// which has targets, modules and templates like .fint/builtin.
+func EmbeddedConfig() fs.FS {
+	sub, _ := fs.Sub(embedded, common.DirConfigDefault+"/"+common.DirBuiltin)
+	return sub
+}
+
+// ConfigLayer is a directory which has targets, modules and templates.
+// Names in the layer are slash separated paths in FS.
+type ConfigLayer struct {
+	Name string
+	Path string
+	FS   fs.FS
+}
+
+// TargetInfo is a target found in the config layers.
+type TargetInfo struct {
+	Id    string
+	Layer string
+	Path  string
+}
+
+// ConfigLayers returns the layers of the config directory in order of precedence:
+// the custom layer of the project, the user layer in $XDG_CONFIG_HOME/fint
+// (~/.config/fint by default), the builtin layer and the embedded layer.
+// Targets, modules and templates in the former layers hide the ones of the same names.
+// The config directory is found by ConfigDir.
+func ConfigLayers(o *common.Opt) (layers []ConfigLayer) {
+	pathConfig := ConfigDir(o)
+	if pathConfig != "" {
+		layers = append(layers, diskLayer(LayerCustom, filepath.Join(pathConfig, common.DirCustom)))
+	}
+	if dir := userConfigDir(); dir != "" {
+		layers = append(layers, diskLayer(LayerUser, dir))
+	}
+	if pathConfig != "" {
+		layers = append(layers, diskLayer(LayerBuiltin, filepath.Join(pathConfig, common.DirBuiltin)))
+	}
+	return append(layers, ConfigLayer{Name: LayerEmbedded, Path: PathEmbedded, FS: EmbeddedConfig()})
+}
+
+// ConfigDir returns the config directory for o.
+// If o.ConfigPath is empty, the nearest .fint is searched upward from the source root
+// and then from the current directory. The search stops at the root of the repository,
+// which has .git. It returns an empty string if .fint is not found.
+func ConfigDir(o *common.Opt) string {
+	if o.ConfigPath != "" {
+		return o.ConfigPath
+	}
+	src := o.SrcRoot
+	if o.Stdin {
+		src = o.StdinFilename
+	}
+	var starts []string
+	if src != "" {
+		if fi, err := os.Stat(src); err == nil && fi.IsDir() {
+			starts = append(starts, src)
+		} else {
+			starts = append(starts, filepath.Dir(src))
+		}
+	}
+	starts = append(starts, ".")
+	for _, start := range starts {
+		if dir := searchConfigDir(start); dir != "" {
+			return dir
+		}
+	}
+	return ""
+}
+
+// searchConfigDir returns the nearest .fint in start or its ancestors up to the repository root.
+func searchConfigDir(start string) string {
+	dir, err := filepath.Abs(start)
+	if err != nil {
+		return ""
+	}
+	for {
+		pathConfig := filepath.Join(dir, common.DirConfigDefault)
+		if fi, err := os.Stat(pathConfig); err == nil && fi.IsDir() {
+			return pathConfig
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return ""
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// printConfig prints the config directory and the targets of id with their layers.
+func printConfig(w io.Writer, o *common.Opt, id string) {
+	layers := ConfigLayers(o)
+	if dir := ConfigDir(o); dir != "" {
+		fmt.Fprintf(w, "Config directory: %s\n", dir)
+	} else {
+		fmt.Fprintln(w, "Config directory: not found, the embedded config is used")
+	}
+	for _, id := range targetIds(id, layers) {
+		if t, _, ok := findTarget(layers, id); ok {
+			fmt.Fprintf(w, "Target %s: %s (%s)\n", t.Id, t.Path, t.Layer)
+		}
+	}
+}
+
+func diskLayer(name, dir string) ConfigLayer {
+	return ConfigLayer{Name: name, Path: dir, FS: os.DirFS(dir)}
+}
+
+// userConfigDir returns the user config directory of fint,
+// or an empty string if it cannot be determined.
+func userConfigDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, common.DirUserConfig)
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", common.DirUserConfig)
+}
+
+// path returns the path of name in the layer to be shown.
+func (c ConfigLayer) path(name string) string {
+	if c.Name == LayerEmbedded {
+		return c.Path + "/" + name
+	}
+	return filepath.Join(c.Path, filepath.FromSlash(name))
+}
+
+// readFile reads the file name in the layer.
+func (c ConfigLayer) readFile(name string) ([]byte, error) {
+	b, err := fs.ReadFile(c.FS, name)
+	if pe, ok := err.(*fs.PathError); ok {
+		pe.Path = c.path(name)
+	}
+	return b, err
+}
+
+// readDir returns the entries of the directory name in the layer.
+// It returns nothing if the directory does not exist.
+func (c ConfigLayer) readDir(name string) []fs.DirEntry {
+	entries, _ := fs.ReadDir(c.FS, name)
+	return entries
+}
+
+// isDir returns whether name in the layer is a directory.
+func (c ConfigLayer) isDir(name string) bool {
+	fi, err := fs.Stat(c.FS, name)
+	return err == nil && fi.IsDir()
+}
+
+// findTarget returns the target id in the first layer which has it.
+func findTarget(layers []ConfigLayer, id string) (info TargetInfo, layer ConfigLayer, ok bool) {
+	dir := path.Join(common.DirTargets, id)
+	for _, layer = range layers {
+		if _, err := fs.Stat(layer.FS, path.Join(dir, common.FileRuleSet)); err == nil {
+			return TargetInfo{Id: id, Layer: layer.Name, Path: layer.path(dir)}, layer, true
+		}
+	}
+	return
+}
+
+// findTemplate returns the layer and the directory of the HTML report template name
+// in the first layer which has it.
+func findTemplate(layers []ConfigLayer, name string) (layer ConfigLayer, dir string) {
+	dir = path.Join(common.DirTemplates, name)
+	for _, layer = range layers {
+		if layer.isDir(dir) {
+			return
+		}
+	}
+	return
+}
+
+// ListTargets returns the targets in all the layers sorted by their IDs.
+// Targets hidden by the former layers are not included.
+func ListTargets(layers []ConfigLayer) (targets []TargetInfo) {
+	seen := make(map[string]bool)
+	for _, layer := range layers {
+		for _, entry := range layer.readDir(common.DirTargets) {
+			name := entry.Name()
+			if seen[name] {
+				continue
+			}
+			if info, _, ok := findTarget(layers, name); ok {
+				seen[name] = true
+				targets = append(targets, info)
+			}
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].Id < targets[j].Id })
+	return
+}
+
+// ListTargetsAsCommand prints the targets with the layers which they come from.
+func ListTargetsAsCommand(o *common.Opt) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	for _, t := range ListTargets(ConfigLayers(o)) {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", t.Id, t.Layer, t.Path)
+	}
+	return w.Flush()
+}
+
+// copyFSFile copies the file name in fsys to dst.
+func copyFSFile(fsys fs.FS, name, dst string) error {
+	b, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(dst, b, 0666)
+}
+
+// copyFSDir copies the directory dir in fsys to dst recursively.
+func copyFSDir(fsys fs.FS, dir, dst string) error {
+	return fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := name
+		if dir != "." {
+			rel = strings.TrimPrefix(strings.TrimPrefix(name, dir), "/")
+		}
+		target := filepath.Join(dst, filepath.FromSlash(rel))
+		if d.IsDir() {
+			return os.MkdirAll(target, 0777)
+		}
+		return copyFSFile(fsys, name, target)
+	})
+}
+
+// Init writes the embedded config to the builtin layer of the config directory
+// to be customized, and creates the custom layer.
+// It returns the directory of the builtin layer.
+func Init(o *common.Opt) (dir string, err error) {
+	pathConfig := o.ConfigPath
+	if pathConfig == "" {
+		pathConfig = common.DirConfigDefault
+	}
+	dir = filepath.Join(pathConfig, common.DirBuiltin)
+	if _, err = os.Stat(dir); err == nil {
+		if !o.Force {
+			return dir, common.NewError("config directory [" + dir + "] already exists. use `-f` option to overwrite.")
+		}
+		if err = os.RemoveAll(dir); err != nil {
+			return
+		}
+	}
+	if err = copyFSDir(EmbeddedConfig(), ".", dir); err != nil {
+		return
+	}
+	err = os.MkdirAll(filepath.Join(pathConfig, common.DirCustom, common.DirTargets), 0777)
+	return
+}
+
+// InitAsCommand writes the embedded config with the options o and prints the result.
+func InitAsCommand(o *common.Opt) (err error) {
+	dir, err := Init(o)
+	if o.Quiet {
+		return
+	}
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("Builtin config written to %s.\n", dir)
+	return
+}
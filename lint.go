@@ -0,0 +1,493 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package fint
+
+import (
+	"github.com/ksoichiro/fint/common"
+	"github.com/ksoichiro/fint/modules"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// check is a module of a rule set to be applied to the matching files.
+type check struct {
+	target  common.Target
+	rs      common.RuleSet
+	m       common.Module
+	mod     modules.Module
+	exclude *modules.IgnoreRules
+	locale  string
+}
+
+// source is a file to be linted with the checks.
+type source struct {
+	filename string
+	checks   []check
+	// Only the violations in the changed lines are reported if diff is true
+	diff    bool
+	changed []lineRange
+	// The staged content in the repository of top is linted instead of the file if staged is true
+	staged bool
+	top    string
+	// Remaining counts of the baseline entries of the file
+	baseline map[baselineKey]int
+}
+
+// fileResult is the result of linting a file.
+type fileResult struct {
+	filename   string
+	vmap       map[int][]common.Violation
+	violations []common.Violation
+	// patch is the unified diff of the fixes with DryRun
+	patch string
+	err   error
+}
+
+// Lint lints the files in srcRoot with all the modules of the loaded target.
+// The tree is walked once, and each file is read once and checked with all
+// the modules matching the file by the workers.
+// Results of the previous Lint are discarded.
+func (l *Linter) Lint(srcRoot string) (err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.violations = []common.Violation{}
+	l.results = make(map[string]map[int][]common.Violation)
+	l.patches = nil
+	if l.config == nil || len(l.config.Targets) == 0 {
+		return common.NewError("config is not loaded.")
+	}
+	var checks []check
+	if checks, err = l.checks(); err != nil {
+		return
+	}
+
+	var sources []source
+	if sources, err = walk(srcRoot, checks); err != nil {
+		return
+	}
+
+	if l.opt.DiffBase != "" || l.opt.Staged {
+		var c changes
+		var top string
+		if c, top, err = gitChanges(srcRoot, l.opt.DiffBase, l.opt.Staged); err != nil {
+			return
+		}
+		sources = c.filter(sources)
+		for i := range sources {
+			sources[i].staged, sources[i].top = l.opt.Staged, top
+		}
+	}
+
+	// Remaining counts of the baseline entries for each file
+	var counts map[string]map[baselineKey]int
+	if l.baseline != nil {
+		counts = l.baseline.counts()
+		if l.opt.DiffBase != "" || l.opt.Staged {
+			// Entries of the files not linted are not known to occur
+			var files []string
+			for i := range sources {
+				files = append(files, l.baseline.file(sources[i].filename))
+			}
+			counts = countsOf(counts, files)
+		}
+		for i := range sources {
+			sources[i].baseline = counts[l.baseline.file(sources[i].filename)]
+		}
+	}
+
+	results := make([]fileResult, len(sources))
+	jobs := make(chan int)
+	done := make(chan bool)
+	n := l.jobs()
+	for w := 0; w < n; w++ {
+		go func() {
+			for i := range jobs {
+				results[i] = l.lintFile(sources[i])
+			}
+			done <- true
+		}()
+	}
+	for i := range sources {
+		jobs <- i
+	}
+	close(jobs)
+	for w := 0; w < n; w++ {
+		<-done
+	}
+
+	// Merge in the order of the walk
+	return l.merge(results, counts)
+}
+
+// LintReader lints the content read from r as the file filename,
+// which does not need to exist. The modules are selected by filename.
+// When fixing, the fixed lines are returned instead of being written to the file.
+// Results of the previous Lint are discarded.
+func (l *Linter) LintReader(r io.Reader, filename string) (lines []string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.violations = []common.Violation{}
+	l.results = make(map[string]map[int][]common.Violation)
+	l.patches = nil
+	if l.config == nil || len(l.config.Targets) == 0 {
+		return nil, common.NewError("config is not loaded.")
+	}
+	var checks []check
+	if checks, err = l.checks(); err != nil {
+		return
+	}
+	if lines, err = modules.ReadLinesFromSize(r, l.opt.BufSize); err != nil {
+		return
+	}
+	src := source{filename: filename, checks: matchingChecks(filename, includedChecks(filepath.ToSlash(filepath.Clean(filename)), false, checks))}
+	var counts map[string]map[baselineKey]int
+	if l.baseline != nil {
+		file := l.baseline.file(filename)
+		counts = countsOf(l.baseline.counts(), []string{file})
+		src.baseline = counts[file]
+	}
+	var result fileResult
+	var fixedLines []string
+	result, fixedLines, _ = l.lintLines(src, lines)
+	if l.opt.DryRun {
+		result.patch = unifiedDiff(filename, lines, fixedLines)
+	}
+	lines = fixedLines
+	err = l.merge([]fileResult{result}, counts)
+	return
+}
+
+// merge stores the results and the baseline entries which no longer occur.
+func (l *Linter) merge(results []fileResult, counts map[string]map[baselineKey]int) error {
+	for i := range results {
+		if results[i].err != nil {
+			return results[i].err
+		}
+		l.results[results[i].filename] = results[i].vmap
+		l.violations = append(l.violations, results[i].violations...)
+		if results[i].patch != "" {
+			l.patches = append(l.patches, results[i].patch)
+		}
+	}
+	if counts != nil && l.opt.ReportUnusedBaseline {
+		unused := l.baseline.unusedEntries(counts)
+		if len(l.config.Targets) == 1 {
+			for i := range unused {
+				unused[i].TargetId = l.config.Targets[0].Id
+			}
+		}
+		l.violations = append(l.violations, unused...)
+	}
+	return nil
+}
+
+// jobs returns the number of the workers.
+func (l *Linter) jobs() int {
+	if 0 < l.opt.Jobs {
+		return l.opt.Jobs
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// checks resolves the modules of the loaded targets in the order of the targets and the rule sets.
+func (l *Linter) checks() (checks []check, err error) {
+	locale := l.opt.Locale
+	if locale == "" {
+		locale = DetectLocale()
+	}
+	for _, target := range l.config.Targets {
+		for i := range target.RuleSets {
+			rs := target.RuleSets[i]
+			for j := range rs.Modules {
+				mod, ok := lookupModule(l.config, rs.Modules[j].Id)
+				if !ok {
+					return nil, errModuleNotRegistered(l.config, target, rs, rs.Modules[j])
+				}
+				m := rs.Modules[j]
+				if m.Rules = enabledRules(m.Rules); len(m.Rules) == 0 {
+					continue
+				}
+				if m.Regexp == nil {
+					// Config is not loaded by LoadConfig
+					if err = modules.Compile(&m, mod); err != nil {
+						return nil, errInvalidPattern(target, rs, m, err)
+					}
+				}
+				c := check{target: target, rs: rs, m: m, mod: mod, locale: targetLocale(target, locale)}
+				if exclude := append(append([]string(nil), rs.Exclude...), m.Exclude...); 0 < len(exclude) {
+					if c.exclude, err = modules.NewIgnoreRules("", exclude); err != nil {
+						return nil, common.NewError("exclude of module [" + m.Id + "] in rule set [" + rs.Id + "] of target [" + target.Id + "]: " + err.Error())
+					}
+				}
+				checks = append(checks, c)
+			}
+		}
+	}
+	return
+}
+
+// enabledRules returns the rules whose severity is not off.
+func enabledRules(rules []common.Rule) (enabled []common.Rule) {
+	for i := range rules {
+		if rules[i].Severity != common.SeverityOff {
+			enabled = append(enabled, rules[i])
+		}
+	}
+	return
+}
+
+// walk returns the files in srcRoot which match to any of the checks
+// in lexical order with the matching checks.
+func walk(srcRoot string, checks []check) (sources []source, err error) {
+	var fi os.FileInfo
+	if fi, err = os.Stat(srcRoot); err != nil {
+		return
+	}
+	if !fi.IsDir() {
+		return walkFile(srcRoot, checks)
+	}
+	return walkDir(srcRoot, "", nil, checks)
+}
+
+// walkFile returns the source of the file filename unless it is ignored or excluded.
+// .fintignore files and the exclude patterns are applied like walkDir from the current
+// directory if filename is in it, otherwise from the directory of filename.
+func walkFile(filename string, checks []check) (sources []source, err error) {
+	root, rel := filepath.Dir(filename), filepath.Base(filename)
+	if wd, err := os.Getwd(); err == nil {
+		if abs, err := filepath.Abs(filename); err == nil {
+			if r, err := filepath.Rel(wd, abs); err == nil && !strings.HasPrefix(r, "..") {
+				root, rel = ".", filepath.ToSlash(r)
+			}
+		}
+	}
+	var ig modules.Ignorer
+	dir, entryRel := root, ""
+	names := strings.Split(rel, "/")
+	for i, name := range names {
+		if ig, err = ig.Enter(dir, entryRel); err != nil {
+			return
+		}
+		dir, entryRel = filepath.Join(dir, name), path.Join(entryRel, name)
+		isDir := i < len(names)-1
+		if ig.Ignored(entryRel, isDir) {
+			return
+		}
+		if checks = includedChecks(entryRel, isDir, checks); len(checks) == 0 {
+			return
+		}
+	}
+	if matched := matchingChecks(filename, checks); 0 < len(matched) {
+		sources = append(sources, source{filename: filename, checks: matched})
+	}
+	return
+}
+
+// walkDir returns the sources in dir, whose path relative to the root of the walk is rel.
+// Files ignored by .fintignore are skipped, and directories excluded
+// by all the checks are skipped without being read.
+func walkDir(dir, rel string, ig modules.Ignorer, checks []check) (sources []source, err error) {
+	if ig, err = ig.Enter(dir, rel); err != nil {
+		return
+	}
+	fis, _ := ioutil.ReadDir(dir)
+	for i := range fis {
+		entry := fis[i]
+		filename := filepath.Join(dir, entry.Name())
+		entryRel := path.Join(rel, entry.Name())
+		if ig.Ignored(entryRel, entry.IsDir()) {
+			continue
+		}
+		included := includedChecks(entryRel, entry.IsDir(), checks)
+		if entry.IsDir() {
+			if len(included) == 0 {
+				continue
+			}
+			var sub []source
+			if sub, err = walkDir(filename, entryRel, ig, included); err != nil {
+				return
+			}
+			sources = append(sources, sub...)
+		} else if matched := matchingChecks(filename, included); 0 < len(matched) {
+			sources = append(sources, source{filename: filename, checks: matched})
+		}
+	}
+	return
+}
+
+// includedChecks returns the checks which do not exclude rel.
+func includedChecks(rel string, isDir bool, checks []check) (included []check) {
+	for i := range checks {
+		if checks[i].exclude != nil {
+			if _, excluded := checks[i].exclude.Match(rel, isDir); excluded {
+				continue
+			}
+		}
+		included = append(included, checks[i])
+	}
+	return
+}
+
+func matchingChecks(filename string, checks []check) (matched []check) {
+	for i := range checks {
+		if checks[i].m.Regexp.MatchString(filename) {
+			matched = append(matched, checks[i])
+		}
+	}
+	return
+}
+
+// annotate sets the IDs of the module, the rule set and the target of c
+// and the severity of the rule to the violations.
+func annotate(vmap map[int][]common.Violation, c check) {
+	for _, vs := range vmap {
+		for i := range vs {
+			vs[i].ModuleId = c.m.Id
+			vs[i].RuleSetId = c.rs.Id
+			vs[i].TargetId = c.target.Id
+			vs[i].Severity = common.SeverityDefault
+			for j := range c.m.Rules {
+				if c.m.Rules[j].Id == vs[i].RuleId && c.m.Rules[j].Severity != "" {
+					vs[i].Severity = c.m.Rules[j].Severity
+				}
+			}
+		}
+	}
+}
+
+// lintFile reads the file once and lints it with the checks.
+// Violations out of the changed lines or counted in the baseline are removed.
+// When fixing, each check sees the lines fixed by the preceding checks,
+// and the file is written once at the end, or the diff is kept with DryRun.
+func (l *Linter) lintFile(src source) (r fileResult) {
+	var lines []string
+	var err error
+	if src.staged {
+		lines, err = stagedLines(src.top, src.filename)
+	} else {
+		lines, err = modules.ReadLinesSize(src.filename, l.opt.BufSize)
+	}
+	if err != nil {
+		r.filename = src.filename
+		r.err = err
+		return
+	}
+	r, fixedLines, fixedAny := l.lintLines(src, lines)
+	if r.err == nil && fixedAny {
+		if l.opt.DryRun {
+			r.patch = unifiedDiff(src.filename, lines, fixedLines)
+		} else {
+			r.err = modules.WriteLines(src.filename, fixedLines)
+		}
+	}
+	return
+}
+
+// lintLines lints the lines of the source, and returns the result and the fixed lines.
+// When fixing, the edits of all the checks are applied together and the lines
+// are linted again until no check fixes them, up to maxFixRounds times.
+// Violations are reported against the fixed lines.
+func (l *Linter) lintLines(src source, lines []string) (r fileResult, fixedLines []string, fixedAny bool) {
+	for round := 0; ; round++ {
+		var edits []edit
+		r, edits = l.lintRound(src, lines, l.opt.Fix && round < maxFixRounds)
+		if r.err != nil {
+			return
+		}
+		if len(edits) == 0 {
+			break
+		}
+		lines = applyEdits(lines, edits)
+		fixedAny = true
+	}
+	fixedLines = lines
+	for n, vs := range r.vmap {
+		for i := range vs {
+			// Fixes which changed nothing are not fixes
+			vs[i].Fixed = false
+			vs[i].Fix = ""
+		}
+		if 0 < n && n <= len(lines) {
+			for i := range vs {
+				vs[i].Fingerprint = fingerprint(lines[n-1])
+			}
+		}
+	}
+	// Violations out of the changed lines are also counted in the baseline
+	if src.baseline != nil {
+		applyBaseline(src.baseline, r.vmap)
+	}
+	if src.diff {
+		filterChanged(src.changed, r.vmap)
+	}
+	var ns []int
+	for n := range r.vmap {
+		ns = append(ns, n)
+	}
+	sort.Ints(ns)
+	for _, n := range ns {
+		r.violations = append(r.violations, r.vmap[n]...)
+	}
+	return
+}
+
+// lintRound lints the lines of the source with all the checks once.
+// When fixing, each check sees the same lines, and the edits of the fixes
+// conflicting with the ones of the preceding checks are discarded.
+func (l *Linter) lintRound(src source, lines []string, fix bool) (r fileResult, edits []edit) {
+	filename, checks := src.filename, src.checks
+	r.filename = filename
+	r.vmap = make(map[int][]common.Violation)
+	// Suppressions for each comment syntax of the rule sets
+	sups := make(map[string][]*suppression)
+	var comments []string
+	for _, c := range checks {
+		vmap, fixed, err := c.mod.Lint(c.m, filename, lines, c.locale, fix)
+		if err != nil {
+			r.err = err
+			return
+		}
+		modules.SetOffsets(vmap, lines)
+		annotate(vmap, c)
+		var suppressed map[int][]string
+		if comment := c.rs.Comment; comment != "" {
+			if _, ok := sups[comment]; !ok {
+				sups[comment] = parseSuppressions(lines, comment)
+				comments = append(comments, comment)
+			}
+			suppressed = suppress(sups[comment], vmap)
+		}
+		for n, vs := range vmap {
+			r.vmap[n] = append(r.vmap[n], vs...)
+		}
+		if fix && fixed != nil {
+			if suppressed != nil {
+				if fixed, err = dropSuppressedFixes(c, filename, lines, fixed, suppressed); err != nil {
+					r.err = err
+					return
+				}
+			}
+			edits = mergeEdits(edits, lineEdits(lines, fixed))
+		}
+	}
+	if l.opt.ReportUnusedSuppressions {
+		for _, comment := range comments {
+			vmap := unusedSuppressions(filename, sups[comment])
+			modules.SetOffsets(vmap, lines)
+			for n, vs := range vmap {
+				for i := range vs {
+					vs[i].TargetId = checks[0].target.Id
+				}
+				r.vmap[n] = append(r.vmap[n], vs...)
+			}
+		}
+	}
+	return
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package fint
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/ksoichiro/fint/common"
+	"os"
+	"path"
+	"strings"
+)
+
+// DetectLocale returns the message locale from the environment variables
+// LC_ALL, LC_MESSAGES and LANG in this order. Values like ja_JP.UTF-8 are normalised to ja.
+// It returns LocaleFallback if none of them is set.
+func DetectLocale() string {
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(name); v != "" {
+			return normalizeLocale(v)
+		}
+	}
+	return common.LocaleFallback
+}
+
+// normalizeLocale returns the language of the POSIX locale s.
+func normalizeLocale(s string) string {
+	if i := strings.IndexAny(s, ".@"); 0 <= i {
+		s = s[:i]
+	}
+	if i := strings.IndexAny(s, "_-"); 0 <= i {
+		s = s[:i]
+	}
+	s = strings.ToLower(s)
+	if s == "" || s == "c" || s == "posix" {
+		return common.LocaleFallback
+	}
+	return s
+}
+
+// targetLocale returns locale if the target has the locale file, otherwise LocaleFallback.
+// Targets not loaded by LoadConfig, which do not know their locales, use locale.
+func targetLocale(target common.Target, locale string) string {
+	if len(target.Locales) == 0 || contains(target.Locales, locale) {
+		return locale
+	}
+	return common.LocaleFallback
+}
+
+// localeKey identifies a rule in locale files.
+type localeKey struct {
+	ruleSet, module, rule string
+}
+
+// localeMessages returns the messages in lt keyed by the IDs of their rules.
+func localeMessages(lt common.LocalizedTarget) map[localeKey]string {
+	messages := make(map[localeKey]string)
+	for _, rs := range lt.RuleSets {
+		for _, m := range rs.Modules {
+			for _, r := range m.Rules {
+				messages[localeKey{rs.Id, m.Id, r.Id}] = r.Message
+			}
+		}
+	}
+	return messages
+}
+
+// LocaleIssue is a missing or an orphaned message in the locales of a target.
+type LocaleIssue struct {
+	Target  string
+	Locale  string
+	RuleSet string
+	Module  string
+	Rule    string
+	// File is the locale file which has the orphaned message.
+	// It is empty for the missing messages.
+	File string
+}
+
+// Orphaned returns whether the message is not for any rule of the target.
+func (i LocaleIssue) Orphaned() bool {
+	return i.File != ""
+}
+
+func (i LocaleIssue) String() string {
+	rule := "rule [" + i.Rule + "] of module [" + i.Module + "] in rule set [" + i.RuleSet + "]"
+	if i.Orphaned() {
+		return i.File + ": orphaned message for " + rule
+	}
+	return "target [" + i.Target + "]: locale [" + i.Locale + "]: missing message for " + rule
+}
+
+// CheckLocales returns the missing and the orphaned messages in the locales
+// of the targets specified by o. If o.Id is empty, all the targets are checked.
+// Messages of the extending targets are checked with the ones of the extended targets.
+func CheckLocales(o *common.Opt) (issues []LocaleIssue, err error) {
+	opt := *o
+	if opt.Id == "" {
+		opt.Id = common.TargetIdAll
+	}
+	config, err := LoadConfig(&opt)
+	if err != nil {
+		return
+	}
+	layers := ConfigLayers(&opt)
+	for _, target := range config.Targets {
+		rules := make(map[localeKey]bool)
+		for _, rs := range target.RuleSets {
+			for _, m := range rs.Modules {
+				for _, r := range m.Rules {
+					rules[localeKey{rs.Id, m.Id, r.Id}] = true
+					for _, locale := range target.Locales {
+						if r.Message[locale] == "" {
+							issues = append(issues, LocaleIssue{Target: target.Id, Locale: locale, RuleSet: rs.Id, Module: m.Id, Rule: r.Id})
+						}
+					}
+				}
+			}
+		}
+
+		_, layer, _ := findTarget(layers, target.Id)
+		dir := path.Join(common.DirTargets, target.Id, common.DirLocales)
+		for _, entry := range layer.readDir(dir) {
+			name := path.Join(dir, entry.Name())
+			b, _ := layer.readFile(name)
+			var lt common.LocalizedTarget
+			json.Unmarshal(b, &lt)
+			for _, rs := range lt.RuleSets {
+				for _, m := range rs.Modules {
+					for _, r := range m.Rules {
+						if !rules[localeKey{rs.Id, m.Id, r.Id}] {
+							issues = append(issues, LocaleIssue{Target: target.Id, Locale: strings.TrimSuffix(entry.Name(), path.Ext(entry.Name())),
+								RuleSet: rs.Id, Module: m.Id, Rule: r.Id, File: layer.path(name)})
+						}
+					}
+				}
+			}
+		}
+	}
+	return
+}
+
+// CheckLocalesAsCommand checks the locales with the options o and prints the issues.
+// It returns an error if any issue is found.
+func CheckLocalesAsCommand(o *common.Opt) (err error) {
+	issues, err := CheckLocales(o)
+	if err == nil && 0 < len(issues) {
+		err = common.NewError("missing or orphaned messages found")
+	}
+	if o.Quiet {
+		return
+	}
+	if 0 < len(issues) {
+		for i := range issues {
+			fmt.Println(issues[i])
+		}
+		fmt.Printf("\n%d %s found.\n", len(issues), pluralize(len(issues), "issue", "issues"))
+	} else if err != nil {
+		fmt.Println(err)
+	}
+	return
+}
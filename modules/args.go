@@ -0,0 +1,121 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package modules
+
+import (
+	"fmt"
+	"github.com/ksoichiro/fint/common"
+	"regexp"
+)
+
+// ArgType is the type of an argument of rules.
+type ArgType int
+
+const (
+	// ArgString is a string.
+	ArgString ArgType = iota
+	// ArgRegexp is a string compiled as a regular expression.
+	// An empty string means that the argument is not used.
+	ArgRegexp
+	// ArgNumber is a number.
+	ArgNumber
+)
+
+// Arg describes an argument of the rules of a module.
+type Arg struct {
+	Name     string
+	Type     ArgType
+	Optional bool
+}
+
+// ArgsDescriber is implemented by modules which describe the arguments of their rules.
+// Arguments of the other modules are passed as they are.
+type ArgsDescriber interface {
+	RuleArgs() []Arg
+}
+
+// LineModule is a line based module with the description of its arguments.
+type LineModule struct {
+	Func LintWalkFunc
+	Args []Arg
+}
+
+func (lm LineModule) Lint(m common.Module, filename string, lines []string, locale string, shouldFix bool) (vmap map[int][]common.Violation, fixed []string, err error) {
+	return lm.Func.Lint(m, filename, lines, locale, shouldFix)
+}
+
+func (lm LineModule) RuleArgs() []Arg {
+	return lm.Args
+}
+
+// CompileError is returned by Compile when a pattern cannot be compiled.
+// Rule is empty if the pattern is the file pattern of the module.
+type CompileError struct {
+	Rule    string
+	Pattern string
+	Err     error
+}
+
+func (e *CompileError) Error() string {
+	if e.Rule == "" {
+		return fmt.Sprintf("invalid pattern [%s]: %v", e.Pattern, e.Err)
+	}
+	return fmt.Sprintf("invalid pattern [%s] in rule [%s]: %v", e.Pattern, e.Rule, e.Err)
+}
+
+// Compile compiles the file pattern of m and the regular expression arguments
+// of its rules described by mod, and stores them to m.
+func Compile(m *common.Module, mod Module) error {
+	re, err := regexp.Compile(m.Pattern)
+	if err != nil {
+		return &CompileError{Pattern: m.Pattern, Err: err}
+	}
+	m.Regexp = re
+	d, ok := mod.(ArgsDescriber)
+	if !ok {
+		return nil
+	}
+	args := d.RuleArgs()
+	for i := range m.Rules {
+		r := &m.Rules[i]
+		r.Regexps = make([]*regexp.Regexp, len(r.Args))
+		for j := range args {
+			if args[j].Type != ArgRegexp || len(r.Args) <= j {
+				continue
+			}
+			pattern, ok := r.Args[j].(string)
+			if !ok {
+				return &CompileError{Rule: r.Id, Pattern: fmt.Sprint(r.Args[j]), Err: fmt.Errorf("%s must be a string", args[j].Name)}
+			}
+			if pattern == "" {
+				continue
+			}
+			if r.Regexps[j], err = regexp.Compile(pattern); err != nil {
+				return &CompileError{Rule: r.Id, Pattern: pattern, Err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// compiled returns m with its patterns compiled if they are not compiled yet.
+func compiled(m common.Module, mod Module) (common.Module, error) {
+	if m.Regexp != nil {
+		return m, nil
+	}
+	// Do not share compiled rules with the caller
+	m.Rules = append([]common.Rule(nil), m.Rules...)
+	err := Compile(&m, mod)
+	return m, err
+}
+
+// argRegexp returns the compiled regular expression of the argument i of the rule r.
+func argRegexp(r common.Rule, i int) *regexp.Regexp {
+	if i < len(r.Regexps) && r.Regexps[i] != nil {
+		return r.Regexps[i]
+	}
+	// Rules not compiled by Compile
+	re, _ := regexp.Compile(r.Args[i].(string))
+	return re
+}
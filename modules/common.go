@@ -5,38 +5,63 @@ package modules
 
 import (
 	"bufio"
+	"bytes"
 	"github.com/ksoichiro/fint/common"
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
-	"regexp"
 	"strings"
 )
 
+// LintWalkFunc checks a line numbered n of the file filename.
+// It implements Module by being called for each line of a file.
 type LintWalkFunc func(m common.Module, n int, filename, line, locale string, shouldFix bool) (vs []common.Violation, fixedAny bool, fixedLine string)
 
 func LintWalk(srcRoot string, m common.Module, locale string, fix bool, lintWalkFunc LintWalkFunc) (fmap map[string]map[int][]common.Violation, err error) {
-	if fmap == nil {
-		fmap = make(map[string]map[int][]common.Violation)
+	return LintWalkModule(srcRoot, m, locale, fix, lintWalkFunc)
+}
+
+// LintWalkModule lints srcRoot with mod. If srcRoot is a directory, all the files
+// in the directory are linted recursively except for the ones ignored by .fintignore.
+func LintWalkModule(srcRoot string, m common.Module, locale string, fix bool, mod Module) (fmap map[string]map[int][]common.Violation, err error) {
+	if m, err = compiled(m, mod); err != nil {
+		return
+	}
+	fi, err := os.Stat(srcRoot)
+	if err != nil {
+		return
+	}
+	if !fi.IsDir() {
+		fmap, err = LintFileModule(srcRoot, m, locale, fix, mod)
+		return
 	}
+	return lintWalkModule(srcRoot, "", nil, m, locale, fix, mod)
+}
 
-	if fi, _ := os.Stat(srcRoot); !fi.IsDir() {
-		fmap, err = LintFile(srcRoot, m, locale, fix, lintWalkFunc)
+// lintWalkModule lints the directory dir, whose path relative to the root of the walk is rel.
+func lintWalkModule(dir, rel string, ig Ignorer, m common.Module, locale string, fix bool, mod Module) (fmap map[string]map[int][]common.Violation, err error) {
+	fmap = make(map[string]map[int][]common.Violation)
+	if ig, err = ig.Enter(dir, rel); err != nil {
 		return
 	}
-	fis, _ := ioutil.ReadDir(srcRoot)
+	fis, _ := ioutil.ReadDir(dir)
 	for i := range fis {
 		entry := fis[i]
-		filename := filepath.Join(srcRoot, entry.Name())
+		filename := filepath.Join(dir, entry.Name())
+		entryRel := path.Join(rel, entry.Name())
+		if ig.Ignored(entryRel, entry.IsDir()) {
+			continue
+		}
 		var fmapSub map[string]map[int][]common.Violation
 		if entry.IsDir() {
-			fmapSub, err = LintWalk(filename, m, locale, fix, lintWalkFunc)
+			fmapSub, err = lintWalkModule(filename, entryRel, ig, m, locale, fix, mod)
 			if err != nil {
 				return
 			}
 		} else {
-			fmapSub, err = LintFile(filename, m, locale, fix, lintWalkFunc)
+			fmapSub, err = LintFileModule(filename, m, locale, fix, mod)
 			if err != nil {
 				return
 			}
@@ -57,13 +82,77 @@ func LintWalk(srcRoot string, m common.Module, locale string, fix bool, lintWalk
 }
 
 func LintFile(srcRoot string, m common.Module, locale string, fix bool, lintWalkFunc LintWalkFunc) (fmap map[string]map[int][]common.Violation, err error) {
+	return LintFileModule(srcRoot, m, locale, fix, lintWalkFunc)
+}
+
+// LintFileModule lints the file srcRoot with mod if the file matches the pattern of m.
+func LintFileModule(srcRoot string, m common.Module, locale string, fix bool, mod Module) (fmap map[string]map[int][]common.Violation, err error) {
 	filename := srcRoot
-	if matched, _ := regexp.MatchString(m.Pattern, filename); !matched {
+	if m, err = compiled(m, mod); err != nil {
+		return
+	}
+	if !m.Regexp.MatchString(filename) {
 		return
 	}
 	if fmap == nil {
 		fmap = make(map[string]map[int][]common.Violation)
 	}
+	var lines []string
+	lines, err = ReadLines(filename)
+	if err != nil {
+		return
+	}
+	vmap, fixed, err := mod.Lint(m, filename, lines, locale, fix)
+	if err != nil {
+		return
+	}
+	SetOffsets(vmap, lines)
+	if fix && fixed != nil {
+		if err = WriteLines(filename, fixed); err != nil {
+			return
+		}
+	}
+	fmap[filename] = vmap
+	return
+}
+
+// SetOffsets sets the byte offsets in the file of lines to the violations
+// which have columns.
+func SetOffsets(vmap map[int][]common.Violation, lines []string) {
+	offset := 0
+	for i := range lines {
+		vs := vmap[i+1]
+		for j := range vs {
+			if 0 < vs[j].Column {
+				vs[j].Offset = offset + vs[j].Column - 1
+				vs[j].EndOffset = offset + vs[j].EndColumn - 1
+			}
+		}
+		offset += len(lines[i]) + len(common.Linefeed)
+	}
+}
+
+// BufSize returns size if it is positive, otherwise the default buffer size
+// used for reading source files.
+func BufSize(size int) int {
+	if 0 < size {
+		return size
+	}
+	if 0 < common.BufSize {
+		return common.BufSize
+	}
+	return common.DefaultBufSize
+}
+
+// ReadLines reads the file filename and splits it into lines without linefeeds.
+// If the file ends with a linefeed, the last line is empty.
+func ReadLines(filename string) (lines []string, err error) {
+	return ReadLinesSize(filename, 0)
+}
+
+// ReadLinesSize is ReadLines with the buffer of size bytes.
+// The default buffer size is used if size is not positive.
+func ReadLinesSize(filename string, size int) (lines []string, err error) {
 	var f *os.File
 	f, err = os.Open(filename)
 	if err != nil {
@@ -71,55 +160,82 @@ func LintFile(srcRoot string, m common.Module, locale string, fix bool, lintWalk
 		return
 	}
 	defer f.Close()
-	var ftmp *os.File
-	if fix {
-		// Prepare fixed file
-		ftmp, _ = os.OpenFile(filename+".tmp", os.O_RDWR|os.O_CREATE, 0666)
-		defer ftmp.Close()
-	}
-	if common.BufSize == 0 {
-		common.BufSize = common.DefaultBufSize
-	}
-	r := bufio.NewReaderSize(f, common.BufSize)
-	vmap := make(map[int][]common.Violation)
-	for n := 1; true; n++ {
+	return ReadLinesFromSize(f, size)
+}
+
+// ReadLinesFrom reads the lines from r without linefeeds.
+func ReadLinesFrom(rd io.Reader) (lines []string, err error) {
+	return ReadLinesFromSize(rd, 0)
+}
+
+// ReadLinesFromSize is ReadLinesFrom with the buffer of size bytes.
+// The default buffer size is used if size is not positive.
+func ReadLinesFromSize(rd io.Reader, size int) (lines []string, err error) {
+	r := bufio.NewReaderSize(rd, BufSize(size))
+	for {
 		var line string
 		line, err = r.ReadString(common.LinefeedRune)
 		if err != io.EOF && err != nil {
 			return
 		}
-		var lvs []common.Violation
-		vsr, fixedAny, fixedLine := lintWalkFunc(m, n, filename, strings.TrimSuffix(line, common.Linefeed), locale, fix)
-		tmpLine := line
-		if vsr != nil {
-			lvs = append(lvs, vsr...)
-			if fixedAny {
-				if strings.HasSuffix(line, common.Linefeed) {
-					tmpLine = fixedLine + common.Linefeed
-				} else {
-					tmpLine = fixedLine
-				}
-			}
-		}
-		if fix {
-			ftmp.WriteString(tmpLine)
-		}
-		vmap[n] = lvs
+		lines = append(lines, strings.TrimSuffix(line, common.Linefeed))
 		if err == io.EOF {
 			err = nil
 			break
 		}
 	}
-	if fix {
-		ftmp.Close()
-		os.Remove(filename)
-		CopyFile(filename+".tmp", filename)
-		os.Remove(filename + ".tmp")
+	return
+}
+
+// WriteLines replaces the content of the file filename with lines joined by linefeeds.
+// Nothing is written if the content is not changed.
+// The content is written to a temporary file in the same directory, which
+// replaces the file atomically with the mode and the owner of the file.
+// Files with hard links or whose owner cannot be kept are overwritten in place instead.
+// If filename is a symbolic link, the file it refers to is replaced.
+func WriteLines(filename string, lines []string) (err error) {
+	content := []byte(strings.Join(lines, common.Linefeed))
+	if filename, err = filepath.EvalSymlinks(filename); err != nil {
+		return
 	}
-	if fmap[filename] == nil {
-		fmap[filename] = make(map[int][]common.Violation)
+	fi, err := os.Stat(filename)
+	if err != nil {
+		return
+	}
+	if b, err := ioutil.ReadFile(filename); err == nil && bytes.Equal(b, content) {
+		return nil
+	}
+	mode := fi.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)
+	if hardLinked(fi) {
+		return ioutil.WriteFile(filename, content, mode)
+	}
+
+	ftmp, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return
+	}
+	tmp := ftmp.Name()
+	if _, err = ftmp.Write(content); err == nil {
+		err = ftmp.Sync()
+	}
+	if errClose := ftmp.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return
+	}
+	// Changing the owner may clear the setuid bits, so the mode is set after it
+	if err = chown(tmp, fi); err != nil {
+		os.Remove(tmp)
+		return ioutil.WriteFile(filename, content, mode)
+	}
+	if err = os.Chmod(tmp, mode); err == nil {
+		err = os.Rename(tmp, filename)
+	}
+	if err != nil {
+		os.Remove(tmp)
 	}
-	fmap[filename] = vmap
 	return
 }
 
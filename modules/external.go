@@ -0,0 +1,168 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package modules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/ksoichiro/fint/common"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	// ExternalProtocolVersion is the version of the JSON protocol
+	// between fint and external modules.
+	ExternalProtocolVersion = 1
+
+	// DefaultExternalTimeout is the time limit of external modules for each file.
+	DefaultExternalTimeout = 60 * time.Second
+)
+
+// External is a module implemented by an external program.
+//
+// For each file, fint launches the program, writes an ExternalRequest
+// as JSON to its stdin and reads an ExternalResponse as JSON from its stdout.
+// The program must exit with status 0 within Timeout, otherwise the lint fails.
+type External struct {
+	Executable string
+	Args       []string
+	// Timeout is the time limit for each file.
+	// DefaultExternalTimeout is used if it is not positive.
+	Timeout time.Duration
+}
+
+// ExternalRule is a rule passed to external modules.
+type ExternalRule struct {
+	Id   string        `json:"id"`
+	Args []interface{} `json:"args"`
+}
+
+// ExternalRequest is written to stdin of external modules.
+type ExternalRequest struct {
+	Version  int            `json:"version"`
+	Module   string         `json:"module"`
+	Filename string         `json:"filename"`
+	Lines    []string       `json:"lines"`
+	Locale   string         `json:"locale"`
+	Fix      bool           `json:"fix"`
+	Rules    []ExternalRule `json:"rules"`
+}
+
+// ExternalViolation is a violation reported by external modules.
+// If Message is empty, the localized message of the rule is used,
+// whose placeholders are replaced with Params.
+// Column and EndColumn are optional, and EndColumn defaults to the next of Column.
+type ExternalViolation struct {
+	Rule      string            `json:"rule"`
+	Line      int               `json:"line"`
+	Column    int               `json:"column"`
+	EndColumn int               `json:"end_column"`
+	Message   string            `json:"message"`
+	Params    map[string]string `json:"params"`
+	Fixed     bool              `json:"fixed"`
+}
+
+// ExternalResponse is read from stdout of external modules.
+// Fixed holds all the lines of the fixed file, and may be omitted
+// when nothing is fixed.
+type ExternalResponse struct {
+	Violations []ExternalViolation `json:"violations"`
+	Fixed      []string            `json:"fixed"`
+}
+
+// NewExternal returns a module which runs executable with args.
+func NewExternal(executable string, args []interface{}) *External {
+	e := &External{Executable: executable}
+	for i := range args {
+		e.Args = append(e.Args, fmt.Sprint(args[i]))
+	}
+	return e
+}
+
+func (e *External) Lint(m common.Module, filename string, lines []string, locale string, shouldFix bool) (vmap map[int][]common.Violation, fixed []string, err error) {
+	req := ExternalRequest{
+		Version:  ExternalProtocolVersion,
+		Module:   m.Id,
+		Filename: filename,
+		Lines:    lines,
+		Locale:   locale,
+		Fix:      shouldFix,
+		Rules:    []ExternalRule{}}
+	for i := range m.Rules {
+		args := m.Rules[i].Args
+		if args == nil {
+			args = []interface{}{}
+		}
+		req.Rules = append(req.Rules, ExternalRule{Id: m.Rules[i].Id, Args: args})
+	}
+	in, err := json.Marshal(req)
+	if err != nil {
+		return
+	}
+
+	timeout := e.Timeout
+	if timeout <= 0 {
+		timeout = DefaultExternalTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, e.Executable, e.Args...)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err = cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, nil, common.NewError(fmt.Sprintf("external module [%s] timed out after %v for %s", m.Id, timeout, filename))
+		}
+		msg := "external module [" + m.Id + "] failed for " + filename + ": " + err.Error()
+		if s := strings.TrimSpace(stderr.String()); s != "" {
+			msg += ": " + s
+		}
+		return nil, nil, common.NewError(msg)
+	}
+
+	var res ExternalResponse
+	if err = json.Unmarshal(stdout.Bytes(), &res); err != nil {
+		return nil, nil, common.NewError("external module [" + m.Id + "] returned invalid response for " + filename + ": " + err.Error())
+	}
+
+	vmap = make(map[int][]common.Violation)
+	for _, ev := range res.Violations {
+		if ev.Line < 1 || len(lines) < ev.Line {
+			return nil, nil, common.NewError(fmt.Sprintf("external module [%s] returned invalid line %d for %s", m.Id, ev.Line, filename))
+		}
+		msg := ev.Message
+		if msg == "" {
+			found := false
+			for i := range m.Rules {
+				if m.Rules[i].Id == ev.Rule {
+					msg = Message(m.Rules[i], locale, filename, ev.Params)
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, nil, common.NewError("external module [" + m.Id + "] returned unknown rule [" + ev.Rule + "] for " + filename)
+			}
+		}
+		v := common.Violation{Filename: filename, RuleId: ev.Rule, Line: ev.Line, Message: msg, Fixed: shouldFix && ev.Fixed}
+		if 0 < ev.Column {
+			v.Column, v.EndColumn = ev.Column, ev.EndColumn
+			if v.EndColumn <= v.Column {
+				v.EndColumn = v.Column + 1
+			}
+		}
+		vmap[ev.Line] = append(vmap[ev.Line], v)
+	}
+	if shouldFix && res.Fixed != nil {
+		fixed = res.Fixed
+	}
+	return
+}
@@ -0,0 +1,190 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package modules
+
+import (
+	"fmt"
+	"github.com/ksoichiro/fint/common"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreRule is a pattern of .fintignore.
+type IgnoreRule struct {
+	Pattern string
+	exp     *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// IgnoreRules is a list of patterns with the syntax of .gitignore.
+// The patterns are relative to Base, which is a slash separated path
+// relative to the root of the walk. Base is empty for the root.
+type IgnoreRules struct {
+	Base  string
+	Rules []IgnoreRule
+}
+
+// Ignorer is a stack of IgnoreRules from the root of the walk
+// to the current directory. Deeper rules take precedence.
+type Ignorer []*IgnoreRules
+
+// NewIgnoreRules compiles patterns relative to base.
+// Blank patterns and patterns starting with '#' are skipped.
+func NewIgnoreRules(base string, patterns []string) (r *IgnoreRules, err error) {
+	r = &IgnoreRules{Base: base}
+	for _, p := range patterns {
+		var rule IgnoreRule
+		var ok bool
+		if rule, ok, err = newIgnoreRule(p); err != nil {
+			return nil, err
+		} else if ok {
+			r.Rules = append(r.Rules, rule)
+		}
+	}
+	return
+}
+
+// ReadIgnoreFile reads .fintignore in dir, whose path relative to the root
+// of the walk is base. It returns nil if the file does not exist.
+func ReadIgnoreFile(dir, base string) (r *IgnoreRules, err error) {
+	file := filepath.Join(dir, common.FileIgnore)
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			err = nil
+		}
+		return
+	}
+	if r, err = NewIgnoreRules(base, strings.Split(string(b), common.Linefeed)); err != nil {
+		return nil, common.NewError(file + ": " + err.Error())
+	}
+	return
+}
+
+func newIgnoreRule(p string) (rule IgnoreRule, ok bool, err error) {
+	p = strings.TrimSuffix(p, "\r")
+	// Trailing spaces are ignored unless they are escaped
+	for strings.HasSuffix(p, " ") && !strings.HasSuffix(p, "\\ ") {
+		p = strings.TrimSuffix(p, " ")
+	}
+	if p == "" || strings.HasPrefix(p, "#") {
+		return
+	}
+	rule.Pattern = p
+	if strings.HasPrefix(p, "!") {
+		rule.negate = true
+		p = p[1:]
+	} else if strings.HasPrefix(p, "\\!") || strings.HasPrefix(p, "\\#") {
+		p = p[1:]
+	}
+	if strings.HasSuffix(p, "/") {
+		rule.dirOnly = true
+		p = strings.TrimSuffix(p, "/")
+	}
+	// Patterns with slashes are relative to the base,
+	// and the others match to the names at any level.
+	expr := "^(?:.*/)?"
+	if strings.Contains(p, "/") {
+		expr = "^"
+		p = strings.TrimPrefix(p, "/")
+	}
+	if p == "" {
+		return
+	}
+	if rule.exp, err = regexp.Compile(expr + globToRegexp(p) + "$"); err != nil {
+		err = fmt.Errorf("invalid pattern [%s]: %v", rule.Pattern, err)
+		return
+	}
+	ok = true
+	return
+}
+
+// globToRegexp converts a glob pattern of .gitignore to a regular expression.
+func globToRegexp(p string) string {
+	var b strings.Builder
+	for i := 0; i < len(p); i++ {
+		c := p[i]
+		switch {
+		case strings.HasPrefix(p[i:], "**/") && (i == 0 || p[i-1] == '/'):
+			// Zero or more directories
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(p[i:], "**") && i+2 == len(p) && (i == 0 || p[i-1] == '/'):
+			// Everything inside
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(p[i+1:], ']')
+			if end < 0 {
+				b.WriteString("\\[")
+				continue
+			}
+			class := p[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(p):
+			i++
+			b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(p[i : i+1]))
+		}
+	}
+	return b.String()
+}
+
+// Match returns whether rel, a slash separated path relative to the root
+// of the walk, matches any of the rules, and whether it is ignored by the
+// last matching rule.
+func (r *IgnoreRules) Match(rel string, isDir bool) (matched, ignored bool) {
+	if r.Base != "" {
+		if !strings.HasPrefix(rel, r.Base+"/") {
+			return
+		}
+		rel = strings.TrimPrefix(rel, r.Base+"/")
+	}
+	for i := range r.Rules {
+		rule := r.Rules[i]
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.exp.MatchString(rel) {
+			matched, ignored = true, !rule.negate
+		}
+	}
+	return
+}
+
+// Ignored returns whether rel is ignored by the rules in the stack.
+func (ig Ignorer) Ignored(rel string, isDir bool) (ignored bool) {
+	for _, r := range ig {
+		if r == nil {
+			continue
+		}
+		if matched, i := r.Match(rel, isDir); matched {
+			ignored = i
+		}
+	}
+	return
+}
+
+// Enter returns the stack with .fintignore in dir, whose path relative to
+// the root of the walk is rel.
+func (ig Ignorer) Enter(dir, rel string) (Ignorer, error) {
+	r, err := ReadIgnoreFile(dir, rel)
+	if err != nil || r == nil {
+		return ig, err
+	}
+	return append(ig[:len(ig):len(ig)], r), nil
+}
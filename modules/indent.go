@@ -8,35 +8,45 @@ import (
 	"regexp"
 )
 
+var (
+	// Tabs for the indent
+	indentTabsExp = regexp.MustCompile("^\\t+")
+	// The last tab of the indent
+	indentLastTabExp = regexp.MustCompile("^(\\t*)(\\t)([^\\t]|$)")
+)
+
+func init() {
+	Register("indent", LineModule{Func: LintIndentFunc, Args: []Arg{
+		Arg{Name: "width", Type: ArgNumber}}})
+}
+
 func LintIndentFunc(m common.Module, n int, filename, line, locale string, shouldFix bool) (vs []common.Violation, fixedAny bool, fixedLine string) {
 	in := line
 	for i := range m.Rules {
-		var pattern string
+		var exp, expRepl *regexp.Regexp
 		var replace string
 		switch m.Rules[i].Id {
-			case "Whitespaces":
-				pattern = "\\t"
-				replace = ""
-				for j := 0; j < int(m.Rules[i].Args[0].(float64)); j++ {
-					replace += " "
-				}
-			default:
-				return
+		case "Whitespaces":
+			exp = indentTabsExp
+			expRepl = indentLastTabExp
+			replace = ""
+			for j := 0; j < int(m.Rules[i].Args[0].(float64)); j++ {
+				replace += " "
+			}
+		default:
+			return
 		}
-		if matched, _ := regexp.MatchString("^" + pattern + "+", in); matched {
+		if loc := exp.FindStringIndex(in); loc != nil {
+			match := in[loc[0]:loc[1]]
 			var fixed bool
 			var fix string
 			if shouldFix {
-				patternRepl := "^(" + pattern + "*)(" + pattern + ")([^" + pattern + "]|$)"
 				repl := "$1" + replace + "$3"
-				var matchedRepl bool
 				for true {
-					matchedRepl, _ = regexp.MatchString(patternRepl, in)
-					if !matchedRepl {
+					if !expRepl.MatchString(in) {
 						break
 					}
-					exp, _ := regexp.Compile(patternRepl)
-					fix = exp.ReplaceAllString(in, repl)
+					fix = expRepl.ReplaceAllString(in, repl)
 					if in != fix {
 						in = fix
 						fixed = true
@@ -44,8 +54,8 @@ func LintIndentFunc(m common.Module, n int, filename, line, locale string, shoul
 					}
 				}
 			}
-			v := common.Violation{Filename: filename, Line: n, Message: m.Rules[i].Message[locale],
-				Fixed: fixed, Fix: fix}
+			v := common.Violation{Filename: filename, RuleId: m.Rules[i].Id, Line: n, Column: loc[0] + 1, EndColumn: loc[1] + 1,
+				Message: Message(m.Rules[i], locale, filename, map[string]string{PlaceholderMatch: match}), Fixed: fixed, Fix: fix}
 			vs = append(vs, v)
 		}
 	}
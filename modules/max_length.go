@@ -4,17 +4,29 @@
 package modules
 
 import (
-	"fmt"
 	"github.com/ksoichiro/fint/common"
-	"regexp"
+	"strconv"
+	"strings"
 )
 
+func init() {
+	Register("max_length", LineModule{Func: LintMaxLengthFunc, Args: []Arg{
+		Arg{Name: "pattern", Type: ArgRegexp},
+		Arg{Name: "max", Type: ArgNumber}}})
+}
+
 func LintMaxLengthFunc(m common.Module, n int, filename, line, locale string, shouldFix bool) (vs []common.Violation, fixedAny bool, fixedLine string) {
 	for i := range m.Rules {
-		if matched, _ := regexp.MatchString(m.Rules[i].Args[0].(string), line); matched {
+		if exp := argRegexp(m.Rules[i], 0); exp != nil && exp.MatchString(line) {
 			max_len := int(m.Rules[i].Args[1].(float64))
 			if too_long := max_len < len(line); too_long {
-				v := common.Violation{Filename: filename, Line: n, Message: fmt.Sprintf(m.Rules[i].Message[locale], max_len)}
+				// Range from the first character over the limit
+				// %d of the old messages is the same as {max}
+				msg := strings.Replace(m.Rules[i].LocalizedMessage(locale), "%d", "{"+PlaceholderMax+"}", -1)
+				v := common.Violation{Filename: filename, RuleId: m.Rules[i].Id, Line: n, Column: max_len + 1, EndColumn: len(line) + 1,
+					Message: formatRuleMessage(msg, m.Rules[i], filename, map[string]string{
+						PlaceholderMax:    strconv.Itoa(max_len),
+						PlaceholderActual: strconv.Itoa(len(line))})}
 				vs = append(vs, v)
 			}
 		}
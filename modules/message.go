@@ -0,0 +1,45 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package modules
+
+import (
+	"github.com/ksoichiro/fint/common"
+	"regexp"
+)
+
+const (
+	PlaceholderRule   = "rule"
+	PlaceholderFile   = "file"
+	PlaceholderMatch  = "match"
+	PlaceholderMax    = "max"
+	PlaceholderActual = "actual"
+)
+
+var placeholderExp = regexp.MustCompile(`\{([A-Za-z_]+)\}`)
+
+// FormatMessage replaces the named placeholders such as {max} in msg with params.
+// Unknown placeholders are kept as they are, and other characters such as `%`
+// have no special meaning.
+func FormatMessage(msg string, params map[string]string) string {
+	return placeholderExp.ReplaceAllStringFunc(msg, func(s string) string {
+		if v, ok := params[s[1:len(s)-1]]; ok {
+			return v
+		}
+		return s
+	})
+}
+
+// Message returns the message of the rule r in locale with the placeholders
+// replaced with params. {rule} and {file} are available for all the rules.
+func Message(r common.Rule, locale, filename string, params map[string]string) string {
+	return formatRuleMessage(r.LocalizedMessage(locale), r, filename, params)
+}
+
+func formatRuleMessage(msg string, r common.Rule, filename string, params map[string]string) string {
+	all := map[string]string{PlaceholderRule: r.Id, PlaceholderFile: filename}
+	for k, v := range params {
+		all[k] = v
+	}
+	return FormatMessage(msg, all)
+}
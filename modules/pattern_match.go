@@ -8,27 +8,62 @@ import (
 	"regexp"
 )
 
+func init() {
+	Register("pattern_match", LineModule{Func: LintPatternMatchFunc, Args: []Arg{
+		Arg{Name: "pattern", Type: ArgRegexp},
+		Arg{Name: "exclude", Type: ArgRegexp},
+		Arg{Name: "replacement", Type: ArgString, Optional: true}}})
+}
+
+// matchRange returns the byte range of the first match of exp in s.
+// Capture groups at the start and the end of the match are regarded
+// as the context of the violation, such as `(.*)` in `^(.*)else{`,
+// and excluded from the range unless the range becomes empty.
+func matchRange(exp *regexp.Regexp, s string) (start, end int, matched bool) {
+	loc := exp.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return
+	}
+	start, end, matched = loc[0], loc[1], true
+	if len(loc) < 4 {
+		return
+	}
+	innerStart, innerEnd := start, end
+	if loc[2] == start && 0 <= loc[3] {
+		innerStart = loc[3]
+	}
+	if last := len(loc) - 2; loc[last+1] == end && innerStart <= loc[last] {
+		innerEnd = loc[last]
+	}
+	if innerStart < innerEnd {
+		start, end = innerStart, innerEnd
+	}
+	return
+}
+
 func LintPatternMatchFunc(m common.Module, n int, filename, line, locale string, shouldFix bool) (vs []common.Violation, fixedAny bool, fixedLine string) {
 	in := line
 	for i := range m.Rules {
-		pattern := m.Rules[i].Args[0].(string)
-		if matched, _ := regexp.MatchString(pattern, in); matched {
+		exp := argRegexp(m.Rules[i], 0)
+		if exp == nil {
+			continue
+		}
+		if start, end, matched := matchRange(exp, in); matched {
 			// Pattern to be excluded
 			excludePattern := m.Rules[i].Args[1].(string)
 			if excludePattern != "" {
-				exp, _ := regexp.Compile(pattern)
 				// Exclude this line if the rest string matches to excludePattern
-				if matched, _ := regexp.MatchString(excludePattern, exp.FindString(in)); matched {
+				if excludeExp := argRegexp(m.Rules[i], 1); excludeExp != nil && excludeExp.MatchString(exp.FindString(in)) {
 					continue
 				}
 			}
+			match := in[start:end]
 			var fixed bool
 			var fix string
 			if shouldFix && 3 <= len(m.Rules[i].Args) {
 				for true {
 					// Fix all violations in this line
 					repl := m.Rules[i].Args[2].(string)
-					exp, _ := regexp.Compile(pattern)
 					fix = exp.ReplaceAllString(in, repl)
 					if in == fix {
 						break
@@ -39,8 +74,8 @@ func LintPatternMatchFunc(m common.Module, n int, filename, line, locale string,
 					}
 				}
 			}
-			v := common.Violation{Filename: filename, Line: n, Message: m.Rules[i].Message[locale],
-				Fixed: fixed, Fix: fix}
+			v := common.Violation{Filename: filename, RuleId: m.Rules[i].Id, Line: n, Column: start + 1, EndColumn: end + 1,
+				Message: Message(m.Rules[i], locale, filename, map[string]string{PlaceholderMatch: match}), Fixed: fixed, Fix: fix}
 			vs = append(vs, v)
 		}
 	}
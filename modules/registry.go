@@ -0,0 +1,77 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package modules
+
+import (
+	"github.com/ksoichiro/fint/common"
+	"sort"
+	"sync"
+)
+
+// Module is the interface that lint modules implement.
+//
+// Lint checks the lines of the file filename with the module configuration m.
+// It returns the violations keyed by line number, which starts at 1.
+// If shouldFix is true and any violation has been fixed, fixed holds all the lines
+// of the fixed file, otherwise fixed is nil.
+// An error is returned only when the module itself fails, not for violations.
+type Module interface {
+	Lint(m common.Module, filename string, lines []string, locale string, shouldFix bool) (vmap map[int][]common.Violation, fixed []string, err error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Module)
+)
+
+// Register makes a module available by the ID used in ruleset.json.
+// It panics if Register is called twice with the same ID or if mod is nil.
+func Register(id string, mod Module) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if mod == nil {
+		panic("fint: Register module is nil")
+	}
+	if _, dup := registry[id]; dup {
+		panic("fint: Register called twice for module " + id)
+	}
+	registry[id] = mod
+}
+
+// Lookup returns the module registered with the ID.
+func Lookup(id string) (mod Module, ok bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	mod, ok = registry[id]
+	return
+}
+
+// Registered returns the sorted IDs of the registered modules.
+func Registered() (ids []string) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	for id := range registry {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return
+}
+
+// Lint implements Module by calling f for each line.
+func (f LintWalkFunc) Lint(m common.Module, filename string, lines []string, locale string, shouldFix bool) (vmap map[int][]common.Violation, fixed []string, err error) {
+	vmap = make(map[int][]common.Violation)
+	for i := range lines {
+		n := i + 1
+		vs, fixedAny, fixedLine := f(m, n, filename, lines[i], locale, shouldFix)
+		vmap[n] = vs
+		if vs != nil && fixedAny {
+			if fixed == nil {
+				fixed = make([]string, len(lines))
+				copy(fixed, lines)
+			}
+			fixed[i] = fixedLine
+		}
+	}
+	return
+}
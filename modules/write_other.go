@@ -0,0 +1,20 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+//go:build !unix
+
+package modules
+
+import (
+	"os"
+)
+
+// hardLinked returns false because the number of the links is not available.
+func hardLinked(fi os.FileInfo) bool {
+	return false
+}
+
+// chown does nothing because the owner of a new file is not changed on this platform.
+func chown(name string, fi os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,26 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+//go:build unix
+
+package modules
+
+import (
+	"os"
+	"syscall"
+)
+
+// hardLinked returns whether the file of fi has other hard links.
+func hardLinked(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && 1 < st.Nlink
+}
+
+// chown changes the owner and the group of the file name to the ones of fi.
+func chown(name string, fi os.FileInfo) error {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return os.Lchown(name, int(st.Uid), int(st.Gid))
+}
@@ -0,0 +1,217 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package fint
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	// patchContext is the number of the unchanged lines around the changes in a hunk.
+	patchContext = 3
+
+	noNewline = "\\ No newline at end of file"
+)
+
+// diffOp is a line of the edit script, whose kind is ' ', '-' or '+'.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// patchLines returns the lines of the file read by ReadLines to be compared.
+// The last line without a linefeed has the marker of git so that it differs
+// from the same line with a linefeed.
+func patchLines(lines []string) []string {
+	if len(lines) == 0 {
+		return nil
+	}
+	last := len(lines) - 1
+	if lines[last] == "" {
+		return lines[:last]
+	}
+	l := append([]string(nil), lines...)
+	l[last] += "\n" + noNewline
+	return l
+}
+
+// editScript returns the edit script from a to b.
+// Lines of a and b of the same length are compared line by line,
+// which is the case of the most fixes and needs no search.
+// Otherwise the shortest edit script is searched by the Myers' algorithm.
+func editScript(a, b []string) []diffOp {
+	if len(a) == len(b) {
+		return alignedScript(a, b)
+	}
+	n, m := len(a), len(b)
+	// trace[d][k+d] is the furthest x on the diagonal k with d edits.
+	var trace [][]int
+	x, y := 0, 0
+	for d := 0; ; d++ {
+		v := make([]int, 2*d+1)
+		for k := -d; k <= d; k += 2 {
+			if d == 0 {
+				x = 0
+			} else if prev := trace[d-1]; k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+				x = prev[k+1+d-1]
+			} else {
+				x = prev[k-1+d-1] + 1
+			}
+			y = x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+d] = x
+			if n <= x && m <= y {
+				trace = append(trace, v)
+				return backtrack(a, b, trace)
+			}
+		}
+		trace = append(trace, v)
+	}
+}
+
+// alignedScript returns the edit script which replaces the lines of a with the lines
+// of b at the same positions. Each block of the changed lines is removed and then added.
+func alignedScript(a, b []string) (ops []diffOp) {
+	for i := 0; i < len(a); {
+		if a[i] == b[i] {
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			continue
+		}
+		j := i
+		for j < len(a) && a[j] != b[j] {
+			j++
+		}
+		for k := i; k < j; k++ {
+			ops = append(ops, diffOp{'-', a[k]})
+		}
+		for k := i; k < j; k++ {
+			ops = append(ops, diffOp{'+', b[k]})
+		}
+		i = j
+	}
+	return
+}
+
+// backtrack returns the edit script of the paths in trace found by editScript.
+func backtrack(a, b []string, trace [][]int) []diffOp {
+	var ops []diffOp
+	x, y := len(a), len(b)
+	for d := len(trace) - 1; 0 < d; d-- {
+		prev := trace[d-1]
+		k := x - y
+		var pk int
+		if k == -d || (k != d && prev[k-1+d-1] < prev[k+1+d-1]) {
+			pk = k + 1
+		} else {
+			pk = k - 1
+		}
+		px := prev[pk+d-1]
+		py := px - pk
+		for px < x && py < y {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', a[x]})
+		}
+		if x == px {
+			y--
+			ops = append(ops, diffOp{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', a[x]})
+		}
+	}
+	for 0 < x {
+		x--
+		ops = append(ops, diffOp{' ', a[x]})
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops
+}
+
+// patchPath returns filename relative to the current directory if possible,
+// so that the patch can be applied with `git apply`.
+// The other absolute paths are returned without the leading slash like git.
+func patchPath(filename string) string {
+	if filepath.IsAbs(filename) {
+		if wd, err := os.Getwd(); err == nil {
+			if rel, err := filepath.Rel(wd, filename); err == nil && !strings.HasPrefix(rel, "..") {
+				filename = rel
+			}
+		}
+	}
+	return strings.TrimPrefix(filepath.ToSlash(filename), "/")
+}
+
+// unifiedDiff returns the unified diff of the lines of filename before and after fixing.
+// It returns an empty string if they are the same.
+func unifiedDiff(filename string, before, after []string) string {
+	ops := editScript(patchLines(before), patchLines(after))
+	var changes []int
+	for i := range ops {
+		if ops[i].kind != ' ' {
+			changes = append(changes, i)
+		}
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+	var buf bytes.Buffer
+	name := patchPath(filename)
+	fmt.Fprintf(&buf, "--- a/%s\n+++ b/%s\n", name, name)
+
+	// Line numbers of the start of ops[i]
+	la, lb := make([]int, len(ops)+1), make([]int, len(ops)+1)
+	la[0], lb[0] = 1, 1
+	for i := range ops {
+		la[i+1], lb[i+1] = la[i], lb[i]
+		if ops[i].kind != '+' {
+			la[i+1]++
+		}
+		if ops[i].kind != '-' {
+			lb[i+1]++
+		}
+	}
+	for i := 0; i < len(changes); {
+		// Merge the changes whose contexts overlap or adjoin
+		j := i
+		for j+1 < len(changes) && changes[j+1]-changes[j] <= 2*patchContext+1 {
+			j++
+		}
+		start := changes[i] - patchContext
+		if start < 0 {
+			start = 0
+		}
+		end := changes[j] + patchContext + 1
+		if len(ops) < end {
+			end = len(ops)
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(la[start], la[end]-la[start]), hunkRange(lb[start], lb[end]-lb[start]))
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(&buf, "%c%s\n", op.kind, op.line)
+		}
+		i = j + 1
+	}
+	return buf.String()
+}
+
+// hunkRange returns the range of the lines in a hunk header like "1,3".
+func hunkRange(start, n int) string {
+	switch n {
+	case 0:
+		return fmt.Sprintf("%d,0", start-1)
+	case 1:
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, n)
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package fint
+
+import (
+	"github.com/ksoichiro/fint/common"
+	"regexp"
+	"strings"
+)
+
+const (
+	DirectiveDisableNextLine = "disable-next-line"
+	DirectiveDisableFile     = "disable-file"
+	DirectiveDisable         = "disable"
+	DirectiveEnable          = "enable"
+
+	// RuleIdUnusedSuppression is the rule ID of the violations of unused suppressions.
+	RuleIdUnusedSuppression = "UnusedSuppression"
+)
+
+var ruleIdExp = regexp.MustCompile("^[A-Za-z0-9_]+$")
+
+// suppression suppresses the violations of a rule from the line start to end
+// by a comment directive in the source file.
+// Rule is empty if the violations of all the rules are suppressed.
+type suppression struct {
+	rule       string
+	line       int
+	column     int
+	endColumn  int
+	start, end int
+	used       bool
+}
+
+// directiveRegexp returns the regular expression of the directives
+// in the comments starting with comment.
+func directiveRegexp(comment string) *regexp.Regexp {
+	return tagRegexp(regexp.QuoteMeta(comment) + "\\s*fint:(" +
+		DirectiveDisableNextLine + "|" + DirectiveDisableFile + "|" + DirectiveDisable + "|" + DirectiveEnable + ")\\b(.*)")
+}
+
+// parseSuppressions returns the suppressions by the directives in lines.
+// Directives are written in the comments starting with comment, such as:
+//
+//	// fint:disable-next-line WhitespaceAfterComma
+//	// fint:disable WhitespaceAfterComma, WhitespaceBeforeElse
+//	// fint:enable
+//	// fint:disable-file
+//
+// Directives without rule IDs suppress all the rules.
+func parseSuppressions(lines []string, comment string) (sups []*suppression) {
+	exp := directiveRegexp(comment)
+	var open []*suppression
+	for i := range lines {
+		loc := exp.FindStringSubmatchIndex(lines[i])
+		if loc == nil {
+			continue
+		}
+		n := i + 1
+		directive := lines[i][loc[2]:loc[3]]
+		rules := ruleIds(lines[i][loc[4]:loc[5]])
+		if directive == DirectiveEnable {
+			var stillOpen []*suppression
+			for _, s := range open {
+				if len(rules) == 0 || contains(rules, s.rule) {
+					s.end = n
+				} else {
+					stillOpen = append(stillOpen, s)
+				}
+			}
+			open = stillOpen
+			continue
+		}
+		if len(rules) == 0 {
+			rules = []string{""}
+		}
+		for _, rule := range rules {
+			s := &suppression{rule: rule, line: n, column: loc[0] + 1, endColumn: loc[1] + 1}
+			switch directive {
+			case DirectiveDisableNextLine:
+				s.start, s.end = n+1, n+1
+			case DirectiveDisableFile:
+				// Including the violations of the file without lines
+				s.start, s.end = 0, len(lines)
+			case DirectiveDisable:
+				s.start, s.end = n, len(lines)
+				open = append(open, s)
+			}
+			sups = append(sups, s)
+		}
+	}
+	return
+}
+
+// ruleIds returns the rule IDs separated with spaces or commas at the start of s.
+func ruleIds(s string) (ids []string) {
+	for _, f := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == '\t' || r == ',' }) {
+		if !ruleIdExp.MatchString(f) {
+			break
+		}
+		ids = append(ids, f)
+	}
+	return
+}
+
+func contains(a []string, s string) bool {
+	for i := range a {
+		if a[i] == s {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *suppression) suppresses(v common.Violation) bool {
+	return s.start <= v.Line && v.Line <= s.end && (s.rule == "" || s.rule == v.RuleId)
+}
+
+// suppress removes the violations suppressed by sups from vmap
+// and marks the suppressions used.
+// It returns the rule IDs of the suppressed violations which were fixed
+// for each line, whose fixes must be dropped.
+func suppress(sups []*suppression, vmap map[int][]common.Violation) (fixed map[int][]string) {
+	for n, vs := range vmap {
+		var kept []common.Violation
+		for i := range vs {
+			suppressed := false
+			for _, s := range sups {
+				if s.suppresses(vs[i]) {
+					s.used = true
+					suppressed = true
+				}
+			}
+			if !suppressed {
+				kept = append(kept, vs[i])
+			} else if vs[i].Fixed {
+				if fixed == nil {
+					fixed = make(map[int][]string)
+				}
+				fixed[n] = append(fixed[n], vs[i].RuleId)
+			}
+		}
+		if len(kept) < len(vs) {
+			vmap[n] = kept
+		}
+	}
+	return
+}
+
+// unusedSuppressions returns the violations of the suppressions which suppressed nothing.
+func unusedSuppressions(filename string, sups []*suppression) (vmap map[int][]common.Violation) {
+	vmap = make(map[int][]common.Violation)
+	for _, s := range sups {
+		if s.used {
+			continue
+		}
+		msg := "Unused suppression"
+		if s.rule != "" {
+			msg += " of " + s.rule
+		}
+		vmap[s.line] = append(vmap[s.line], common.Violation{Filename: filename, RuleId: RuleIdUnusedSuppression,
+			Severity: common.SeverityWarning, Line: s.line, Column: s.column, EndColumn: s.endColumn, Message: msg})
+	}
+	return
+}
@@ -0,0 +1,13 @@
+#!/bin/sh
+
+# Report and fix "a,b" with its column and params
+in=$(cat)
+case "$in" in
+*a,b*)
+    echo '{"violations": [{"rule": "Comma", "line": 1, "column": 6, "end_column": 7, "params": {"name": "a,b"}, "fixed": true}],'
+    echo ' "fixed": ["int a, b;", "int c;", ""]}'
+    ;;
+*)
+    echo '{"violations": []}'
+    ;;
+esac
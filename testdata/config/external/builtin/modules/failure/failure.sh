@@ -0,0 +1,5 @@
+#!/bin/sh
+
+cat > /dev/null
+echo "$1" >&2
+exit 3
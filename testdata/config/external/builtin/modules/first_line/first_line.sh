@@ -0,0 +1,5 @@
+#!/bin/sh
+
+# Report the first line of every file
+cat > /dev/null
+echo '{"violations": [{"rule": "FirstLine", "line": 1}]}'
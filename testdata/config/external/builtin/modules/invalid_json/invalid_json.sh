@@ -0,0 +1,4 @@
+#!/bin/sh
+
+cat > /dev/null
+echo "not json"
@@ -0,0 +1,4 @@
+#!/bin/sh
+
+cat > /dev/null
+echo '{"violations": [{"rule": "InvalidLine", "line": 10000}]}'
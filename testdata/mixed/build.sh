@@ -0,0 +1 @@
+ls &> /dev/null
@@ -0,0 +1,3 @@
+// fint:disable-file
+int a,b;
+}else {
@@ -0,0 +1,11 @@
+// fint:disable-next-line WhitespaceAfterComma
+int a,b;
+int c,d;
+// fint:disable WhitespaceAfterComma, WhitespaceBeforeElse
+int e,f;
+}else {
+// fint:enable
+int g,h; // fint:disable-next-line ExceedMaxLength
+int i,j;
+// fint:disable-next-line WhitespaceAfterComma
+}else {int k,l;}
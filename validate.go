@@ -0,0 +1,448 @@
+// Copyright (c) 2014 Soichiro Kashima
+// Licensed under MIT license.
+
+package fint
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/ksoichiro/fint/common"
+	"github.com/ksoichiro/fint/modules"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Problem is a problem found in a config file.
+// Location is the JSON location in the file such as `rulesets[0].modules[1].id`.
+type Problem struct {
+	File     string
+	Location string
+	Message  string
+}
+
+func (p Problem) String() string {
+	if p.Location == "" {
+		return p.File + ": " + p.Message
+	}
+	return p.File + ": " + p.Location + ": " + p.Message
+}
+
+// ValidationError is returned when the config files have problems.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var lines []string
+	for i := range e.Problems {
+		lines = append(lines, common.NewError(e.Problems[i].String()).Error())
+	}
+	return strings.Join(lines, common.Linefeed)
+}
+
+// Validate checks the module configs and the targets in the config layers.
+// If o.Id is empty, all the targets are checked.
+// Problems in the config files are returned as problems, and err is returned
+// only when the config directory cannot be read.
+func Validate(o *common.Opt) (problems []Problem, err error) {
+	pathConfig := o.ConfigPath
+	if pathConfig != "" {
+		if err = dirExists(pathConfig); err != nil {
+			return
+		}
+	}
+	if err = checkBuiltinModules(pathConfig); err != nil {
+		return
+	}
+	layers := ConfigLayers(o)
+	config := new(common.Config)
+	if config.ModuleConfigs, problems, err = loadLayerModuleConfigs(layers); err != nil {
+		return
+	}
+
+	id := o.Id
+	if id == "" {
+		id = common.TargetIdAll
+	}
+	for _, id := range targetIds(id, layers) {
+		t, layer, ok := findTarget(layers, id)
+		if !ok {
+			problems = append(problems, Problem{File: layers[0].path(path.Join(common.DirTargets, id, common.FileRuleSet)),
+				Message: "no matching target to [" + id + "]"})
+			continue
+		}
+		_, p, err := loadTarget(layers, layer, id, config, nil)
+		if err != nil {
+			problems = append(problems, Problem{File: filepath.Join(t.Path, common.FileRuleSet), Message: err.Error()})
+			continue
+		}
+		problems = appendProblems(problems, p...)
+	}
+	return
+}
+
+// appendProblems appends the problems which are not in problems yet,
+// because the problems of a target are also reported by the targets extending it.
+func appendProblems(problems []Problem, p ...Problem) []Problem {
+	for i := range p {
+		found := false
+		for j := range problems {
+			if problems[j] == p[i] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, p[i])
+		}
+	}
+	return problems
+}
+
+// validator collects the problems in a JSON file.
+type validator struct {
+	file     string
+	problems []Problem
+}
+
+func (v *validator) add(loc, format string, args ...interface{}) {
+	v.problems = append(v.problems, Problem{File: v.file, Location: loc, Message: fmt.Sprintf(format, args...)})
+}
+
+// parse parses b as JSON. Syntax errors are located by line and column.
+func (v *validator) parse(b []byte) (root interface{}, ok bool) {
+	if err := json.Unmarshal(b, &root); err != nil {
+		if se, isSyntax := err.(*json.SyntaxError); isSyntax {
+			line := bytes.Count(b[:se.Offset], []byte(common.Linefeed)) + 1
+			col := int(se.Offset) - bytes.LastIndex(b[:se.Offset], []byte(common.Linefeed)) - 1
+			v.add(fmt.Sprintf("line %d, column %d", line, col), "%v", err)
+		} else {
+			v.add("", "%v", err)
+		}
+		return nil, false
+	}
+	return root, true
+}
+
+// object checks that x is an object which has only the keys.
+func (v *validator) object(loc string, x interface{}, keys ...string) (obj map[string]interface{}, ok bool) {
+	if obj, ok = x.(map[string]interface{}); !ok {
+		v.add(loc, "must be an object")
+		return
+	}
+	for k := range obj {
+		known := false
+		for i := range keys {
+			if k == keys[i] {
+				known = true
+				break
+			}
+		}
+		if !known {
+			v.add(childLoc(loc, k), "unknown item")
+		}
+	}
+	return
+}
+
+// str returns the string item key in obj.
+func (v *validator) str(loc string, obj map[string]interface{}, key string, required bool) (s string, ok bool) {
+	x, exists := obj[key]
+	if !exists {
+		if required {
+			v.add(childLoc(loc, key), "is required")
+		}
+		return
+	}
+	if s, ok = x.(string); !ok {
+		v.add(childLoc(loc, key), "must be a string")
+	}
+	return
+}
+
+// array returns the array item key in obj.
+func (v *validator) array(loc string, obj map[string]interface{}, key string, required bool) (a []interface{}, ok bool) {
+	x, exists := obj[key]
+	if !exists {
+		if required {
+			v.add(childLoc(loc, key), "is required")
+		}
+		return
+	}
+	if a, ok = x.([]interface{}); !ok {
+		v.add(childLoc(loc, key), "must be an array")
+	}
+	return
+}
+
+// exclude checks the optional array of the exclude patterns in obj.
+func (v *validator) exclude(loc string, obj map[string]interface{}) {
+	a, _ := v.array(loc, obj, "exclude", false)
+	for i := range a {
+		p, ok := a[i].(string)
+		if !ok {
+			v.add(indexLoc(childLoc(loc, "exclude"), i), "must be a string")
+			continue
+		}
+		if _, err := modules.NewIgnoreRules("", []string{p}); err != nil {
+			v.add(indexLoc(childLoc(loc, "exclude"), i), "%v", err)
+		}
+	}
+}
+
+// id returns the non-empty string item `id` in obj, which must not be in seen.
+func (v *validator) id(loc string, obj map[string]interface{}, seen map[string]bool) (id string, ok bool) {
+	if id, ok = v.str(loc, obj, "id", true); !ok {
+		return
+	}
+	if id == "" {
+		v.add(childLoc(loc, "id"), "must not be empty")
+		return id, false
+	}
+	if seen != nil {
+		if seen[id] {
+			v.add(childLoc(loc, "id"), "duplicate ID [%s]", id)
+		}
+		seen[id] = true
+	}
+	return
+}
+
+func childLoc(loc, key string) string {
+	if loc == "" {
+		return key
+	}
+	return loc + "." + key
+}
+
+func indexLoc(loc string, i int) string {
+	return fmt.Sprintf("%s[%d]", loc, i)
+}
+
+// validateModuleConfig checks config.json of a module.
+func validateModuleConfig(file string, b []byte) []Problem {
+	v := &validator{file: file}
+	root, ok := v.parse(b)
+	if !ok {
+		return v.problems
+	}
+	obj, ok := v.object("", root, "type", "description", "executable", "args", "timeout")
+	if !ok {
+		return v.problems
+	}
+	typ, ok := v.str("", obj, "type", false)
+	if ok && typ != common.ModuleTypeBuiltin && typ != common.ModuleTypeExternal {
+		v.add("type", "must be [%s] or [%s] but was [%s]", common.ModuleTypeBuiltin, common.ModuleTypeExternal, typ)
+	}
+	v.str("", obj, "description", false)
+	v.array("", obj, "args", false)
+	if typ == common.ModuleTypeExternal {
+		if exe, ok := v.str("", obj, "executable", true); ok {
+			if exe == "" {
+				v.add("executable", "must not be empty")
+			} else if !filepath.IsAbs(exe) && strings.ContainsAny(exe, "/\\") {
+				if _, err := os.Stat(filepath.Join(filepath.Dir(file), exe)); err != nil {
+					v.add("executable", "executable [%s] not found", exe)
+				}
+			}
+		}
+		if x, exists := obj["timeout"]; exists {
+			if n, isNumber := x.(float64); !isNumber || n <= 0 {
+				v.add("timeout", "must be a positive number")
+			}
+		}
+	} else {
+		// Builtin modules which are not registered are reported
+		// only when they are used in the rule sets.
+		v.str("", obj, "executable", false)
+		if _, exists := obj["timeout"]; exists {
+			v.add("timeout", "is available only for external modules")
+		}
+	}
+	return v.problems
+}
+
+// validateRuleSet checks ruleset.json of the target id.
+// Modules used in the rule sets are resolved with config.
+func validateRuleSet(file string, b []byte, id string, config *common.Config) []Problem {
+	v := &validator{file: file}
+	root, ok := v.parse(b)
+	if !ok {
+		return v.problems
+	}
+	obj, ok := v.object("", root, "extends", "rulesets")
+	if !ok {
+		return v.problems
+	}
+	// Items of the extending targets may be given only to override
+	extends, _ := v.str("", obj, "extends", false)
+	if _, exists := obj["extends"]; exists && extends == "" {
+		v.add("extends", "must not be empty")
+	}
+	rss, _ := v.array("", obj, "rulesets", true)
+	target := common.Target{Id: id}
+	rsIds := make(map[string]bool)
+	for i := range rss {
+		rsLoc := indexLoc("rulesets", i)
+		rsObj, ok := v.object(rsLoc, rss[i], "id", "description", "comment", "exclude", "modules")
+		if !ok {
+			continue
+		}
+		rsId, _ := v.id(rsLoc, rsObj, rsIds)
+		v.str(rsLoc, rsObj, "description", false)
+		v.str(rsLoc, rsObj, "comment", false)
+		v.exclude(rsLoc, rsObj)
+		rs := common.RuleSet{Id: rsId}
+		ms, _ := v.array(rsLoc, rsObj, "modules", true)
+		for j := range ms {
+			mLoc := indexLoc(childLoc(rsLoc, "modules"), j)
+			mObj, ok := v.object(mLoc, ms[j], "id", "pattern", "exclude", "rules")
+			if !ok {
+				continue
+			}
+			mId, ok := v.id(mLoc, mObj, nil)
+			m := common.Module{Id: mId}
+			var mod modules.Module
+			if ok {
+				if mod, ok = lookupModule(config, mId); !ok {
+					v.add(childLoc(mLoc, "id"), "%s", moduleNotRegisteredMessage(config, target, rs, m))
+				}
+			}
+			if pattern, ok := v.str(mLoc, mObj, "pattern", extends == ""); ok {
+				if _, err := regexp.Compile(pattern); err != nil {
+					v.add(childLoc(mLoc, "pattern"), "%s", invalidPatternMessage(target, rs, m, &modules.CompileError{Pattern: pattern, Err: err}))
+				}
+			}
+			v.exclude(mLoc, mObj)
+			rules, _ := v.array(mLoc, mObj, "rules", true)
+			ruleIds := make(map[string]bool)
+			for k := range rules {
+				rLoc := indexLoc(childLoc(mLoc, "rules"), k)
+				rObj, ok := v.object(rLoc, rules[k], "id", "args", "severity", "remove")
+				if !ok {
+					continue
+				}
+				rId, _ := v.id(rLoc, rObj, ruleIds)
+				if x, exists := rObj["remove"]; exists {
+					if remove, isBool := x.(bool); !isBool {
+						v.add(childLoc(rLoc, "remove"), "must be a boolean")
+					} else if remove && extends == "" {
+						v.add(childLoc(rLoc, "remove"), "is available only for the targets which extend another target")
+					} else if remove {
+						continue
+					}
+				}
+				if s, ok := v.str(rLoc, rObj, "severity", false); ok {
+					if _, ok := common.SeverityLevel(s); !ok || s == "" {
+						v.add(childLoc(rLoc, "severity"), "must be one of [%s], [%s], [%s] and [%s] but was [%s]",
+							common.SeverityError, common.SeverityWarning, common.SeverityInfo, common.SeverityOff, s)
+					}
+				}
+				args, _ := v.array(rLoc, rObj, "args", false)
+				if _, exists := rObj["args"]; !exists && extends != "" {
+					// Arguments of the extended target are used
+					continue
+				}
+				if d, ok := mod.(modules.ArgsDescriber); ok {
+					v.args(childLoc(rLoc, "args"), args, d.RuleArgs(), func(pattern string, err error) string {
+						return invalidPatternMessage(target, rs, m, &modules.CompileError{Rule: rId, Pattern: pattern, Err: err})
+					})
+				}
+			}
+		}
+	}
+	return v.problems
+}
+
+// args checks the arguments of a rule with the description of the module.
+func (v *validator) args(loc string, args []interface{}, desc []modules.Arg, invalidPattern func(string, error) string) {
+	if len(desc) < len(args) {
+		v.add(loc, "too many arguments: at most %d expected but %d found", len(desc), len(args))
+	}
+	for i := range desc {
+		argLoc := indexLoc(loc, i)
+		if len(args) <= i {
+			if !desc[i].Optional {
+				v.add(argLoc, "argument [%s] is required", desc[i].Name)
+			}
+			continue
+		}
+		switch desc[i].Type {
+		case modules.ArgString, modules.ArgRegexp:
+			s, ok := args[i].(string)
+			if !ok {
+				v.add(argLoc, "argument [%s] must be a string", desc[i].Name)
+				continue
+			}
+			if desc[i].Type == modules.ArgRegexp && s != "" {
+				if _, err := regexp.Compile(s); err != nil {
+					v.add(argLoc, "%s", invalidPattern(s, err))
+				}
+			}
+		case modules.ArgNumber:
+			if _, ok := args[i].(float64); !ok {
+				v.add(argLoc, "argument [%s] must be a number", desc[i].Name)
+			}
+		}
+	}
+}
+
+// validateLocale checks a locale file of the target.
+// Messages are matched to the rules by the IDs of the rule sets, the modules and the rules,
+// so the order does not matter and missing messages are not problems.
+// Messages are optional for the targets which extend another target.
+func validateLocale(file string, b []byte, target common.Target) []Problem {
+	v := &validator{file: file}
+	root, ok := v.parse(b)
+	if !ok {
+		return v.problems
+	}
+	obj, ok := v.object("", root, "rulesets")
+	if !ok {
+		return v.problems
+	}
+	rss, ok := v.array("", obj, "rulesets", true)
+	if !ok {
+		return v.problems
+	}
+	rsIds := make(map[string]bool)
+	for i := range rss {
+		rsLoc := indexLoc("rulesets", i)
+		rsObj, ok := v.object(rsLoc, rss[i], "id", "modules")
+		if !ok {
+			continue
+		}
+		v.id(rsLoc, rsObj, rsIds)
+		ms, ok := v.array(rsLoc, rsObj, "modules", true)
+		if !ok {
+			continue
+		}
+		for j := range ms {
+			mLoc := indexLoc(childLoc(rsLoc, "modules"), j)
+			mObj, ok := v.object(mLoc, ms[j], "id", "rules")
+			if !ok {
+				continue
+			}
+			v.id(mLoc, mObj, nil)
+			rules, ok := v.array(mLoc, mObj, "rules", true)
+			if !ok {
+				continue
+			}
+			ruleIds := make(map[string]bool)
+			for k := range rules {
+				rLoc := indexLoc(childLoc(mLoc, "rules"), k)
+				rObj, ok := v.object(rLoc, rules[k], "id", "message")
+				if !ok {
+					continue
+				}
+				v.id(rLoc, rObj, ruleIds)
+				v.str(rLoc, rObj, "message", target.Extends == "")
+			}
+		}
+	}
+	return v.problems
+}